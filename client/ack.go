@@ -0,0 +1,173 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Ack adds socket.io acknowledgements: requests sent as `42N[...]` which the server answers with
+// a matching `43N[...]` packet.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/brisberg/generals-io-bot/client/protocol"
+)
+
+var (
+	// ErrAckTimeout is returned when the server does not acknowledge a request in time
+	ErrAckTimeout = errors.New("Error: Server did not acknowledge the request in time")
+	// ErrConnectionLost is returned for requests still pending when the connection dropped
+	ErrConnectionLost = errors.New("Error: Connection lost before the server acknowledged the request")
+	// ErrDropped is returned for requests dropped from the outbox because too many were queued
+	ErrDropped = errors.New("Error: Request dropped from the full outbox")
+)
+
+// Ack is a pending request which completes when the server acknowledges it, the request's context
+// is done, the connection is lost or the outbox drops it
+type Ack struct {
+	// Packet ID of the request
+	ID int
+
+	done chan struct{}
+	once sync.Once
+	data json.RawMessage
+	err  error
+}
+
+// Done returns a channel which is closed once the request is acknowledged or failed
+func (a *Ack) Done() <-chan struct{} {
+	return a.done
+}
+
+// Wait blocks until the request completes and returns the raw JSON array of acknowledgement arguments
+func (a *Ack) Wait() (json.RawMessage, error) {
+	<-a.done
+	return a.data, a.err
+}
+
+// WaitContext is like Wait, but stops waiting when the given context is done.
+// The request itself stays pending until its own context is done.
+func (a *Ack) WaitContext(ctx context.Context) (json.RawMessage, error) {
+	select {
+	case <-a.done:
+		return a.data, a.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Then calls the callback on a new goroutine once the request completes
+func (a *Ack) Then(callback func(data json.RawMessage, err error)) {
+	go func() {
+		callback(a.Wait())
+	}()
+}
+
+// Completes the request, only the first call has an effect
+func (a *Ack) complete(data json.RawMessage, err error) {
+	a.once.Do(func() {
+		a.data = data
+		a.err = err
+		close(a.done)
+	})
+}
+
+// ackRegistry tracks the requests waiting for an acknowledgement, keyed by packet ID
+type ackRegistry struct {
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]*Ack
+	// Set once the client is closed. Later requests fail immediately
+	closed bool
+}
+
+func newAckRegistry() *ackRegistry {
+	return &ackRegistry{
+		pending: make(map[int]*Ack),
+	}
+}
+
+// Creates a new pending request with the next packet ID. It is already failed with
+// ErrClientClosed if the client is closed
+func (r *ackRegistry) add() *Ack {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a := &Ack{ID: r.nextID, done: make(chan struct{})}
+	r.nextID++
+	if r.closed {
+		a.complete(nil, ErrClientClosed)
+		return a
+	}
+	r.pending[a.ID] = a
+	return a
+}
+
+// Removes and completes the pending request with the given ID, if there is one
+func (r *ackRegistry) resolve(id int, data json.RawMessage, err error) {
+	r.mu.Lock()
+	a, ok := r.pending[id]
+	delete(r.pending, id)
+	r.mu.Unlock()
+
+	if ok {
+		a.complete(data, err)
+	}
+}
+
+// Fails every pending request with the given error
+func (r *ackRegistry) failAll(err error) {
+	r.fail(err, false)
+}
+
+// Fails every pending request with the given error and every later request with ErrClientClosed
+func (r *ackRegistry) close(err error) {
+	r.fail(err, true)
+}
+
+func (r *ackRegistry) fail(err error, closed bool) {
+	r.mu.Lock()
+	r.closed = r.closed || closed
+	pending := r.pending
+	r.pending = make(map[int]*Ack)
+	r.mu.Unlock()
+
+	for _, a := range pending {
+		a.complete(nil, err)
+	}
+}
+
+// Emit sends an event to the server
+func (c *Client) Emit(event string, args ...interface{}) {
+	c.sendEvent(event, args...)
+}
+
+// EmitWithAck sends an event to the server and returns an Ack which completes when the server
+// acknowledges it. If the context is done first the Ack fails with the context's error, or with
+// ErrAckTimeout if its deadline was exceeded.
+//
+// It is safe to have many requests pending at once, from any number of goroutines.
+func (c *Client) EmitWithAck(ctx context.Context, event string, args ...interface{}) *Ack {
+	a := c.acks.add()
+	p, err := protocol.NewEvent(event, args...)
+	if err != nil {
+		c.acks.resolve(a.ID, nil, err)
+		return a
+	}
+	c.sendSocketPacket(eventPriority(event), p.WithID(a.ID), func() {
+		c.acks.resolve(a.ID, nil, ErrDropped)
+	})
+
+	go func() {
+		select {
+		case <-a.done:
+		case <-ctx.Done():
+			err := ctx.Err()
+			if err == context.DeadlineExceeded {
+				err = ErrAckTimeout
+			}
+			c.acks.resolve(a.ID, nil, err)
+		}
+	}()
+	return a
+}
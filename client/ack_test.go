@@ -0,0 +1,121 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/client"
+	"github.com/brisberg/generals-io-bot/client/fakeserver"
+	"github.com/brisberg/generals-io-bot/logger"
+)
+
+// Connects a client to the fake server and runs it until the test ends
+func runClient(t *testing.T, s *fakeserver.Server, options client.Options) *client.Client {
+	t.Helper()
+	if options.URL == "" {
+		options.URL = s.URL()
+	}
+	if options.Logger == nil {
+		options.Logger = logger.Nop()
+	}
+	c, err := client.ConnectWithOptions(context.Background(), options)
+	if err != nil {
+		t.Fatalf("ConnectWithOptions: %v", err)
+	}
+	go c.Run(context.Background())
+	t.Cleanup(func() { c.Close("Test done.") })
+	return c
+}
+
+func TestEmitWithAck(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	s.SetUsername("user1", "[Bot]one")
+	c := runClient(t, s, client.Options{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	data, err := c.EmitWithAck(ctx, "get_username", "user1").Wait()
+	if err != nil || string(data) != `["[Bot]one"]` {
+		t.Errorf("EmitWithAck = %s, %v, want [\"[Bot]one\"]", data, err)
+	}
+}
+
+func TestEmitWithAckTimeout(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	// Never acknowledge
+	s.Handle("get_username", func(*fakeserver.Conn, fakeserver.Event) {})
+	c := runClient(t, s, client.Options{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := c.EmitWithAck(ctx, "get_username", "user1").Wait(); !errors.Is(err, client.ErrAckTimeout) {
+		t.Errorf("EmitWithAck = %v, want %v", err, client.ErrAckTimeout)
+	}
+}
+
+func TestEmitWithAckAfterClose(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	c := runClient(t, s, client.Options{})
+	c.Close("Closed by test.")
+
+	done := make(chan error, 1)
+	go func() { done <- c.RegisterBot(context.Background(), "user1", "[Bot]one") }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, client.ErrClientClosed) {
+			t.Errorf("RegisterBot after Close = %v, want %v", err, client.ErrClientClosed)
+		}
+	case <-time.After(timeout):
+		t.Fatal("RegisterBot after Close did not return")
+	}
+}
+
+func TestEmitWithAckPendingOnClose(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	s.Handle("get_username", func(*fakeserver.Conn, fakeserver.Event) {})
+	c := runClient(t, s, client.Options{})
+
+	a := c.EmitWithAck(context.Background(), "get_username", "user1")
+	if _, err := s.Next("get_username", timeout); err != nil {
+		t.Fatal(err)
+	}
+	c.Close("Closed by test.")
+
+	select {
+	case <-a.Done():
+		if _, err := a.Wait(); !errors.Is(err, client.ErrConnectionLost) {
+			t.Errorf("pending Ack = %v, want %v", err, client.ErrConnectionLost)
+		}
+	case <-time.After(timeout):
+		t.Fatal("pending Ack was not failed when the client closed")
+	}
+}
+
+func TestEmitWithAckDroppedFromOutbox(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	policy := client.OutboxPolicy{Lobby: client.ClassPolicy{MaxDepth: 1, Drop: client.DropOldest}}
+	c, err := client.ConnectWithOptions(context.Background(), client.Options{URL: s.URL(), Outbox: &policy, Logger: logger.Nop()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close("Test done.")
+
+	// Without Run nothing is sent, so the second request pushes the first out of the queue
+	first := c.EmitWithAck(context.Background(), "get_username", "user1")
+	c.EmitWithAck(context.Background(), "get_username", "user2")
+	select {
+	case <-first.Done():
+		if _, err := first.Wait(); !errors.Is(err, client.ErrDropped) {
+			t.Errorf("dropped Ack = %v, want %v", err, client.ErrDropped)
+		}
+	case <-time.After(timeout):
+		t.Fatal("dropped Ack is still pending")
+	}
+}
@@ -0,0 +1,178 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Capture adds recording of the WebSocket traffic to a JSONL file, and an offline replayer which
+// feeds a capture back through the client's dispatch path.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/client/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// Direction is the direction of a captured frame
+type Direction string
+
+const (
+	// Inbound frames were received from the server
+	Inbound Direction = "in"
+	// Outbound frames were sent to the server
+	Outbound Direction = "out"
+)
+
+// Frame is a WebSocket frame recorded in a capture. Exactly one of Text and Binary is set
+type Frame struct {
+	// Time since the recording started, measured on the monotonic clock
+	Elapsed   time.Duration `json:"t"`
+	Direction Direction     `json:"dir"`
+	Text      string        `json:"text,omitempty"`
+	Binary    []byte        `json:"binary,omitempty"`
+}
+
+// Returns the WebSocket message type and payload of the frame
+func (f Frame) message() (int, []byte) {
+	if f.Binary != nil {
+		return websocket.BinaryMessage, f.Binary
+	}
+	return websocket.TextMessage, []byte(f.Text)
+}
+
+// Recorder writes every frame the client exchanges with the server as one JSON object per line,
+// including the handshake of every connection. Outbound frames are recorded once they were sent.
+// Set it in Options.Recorder. It is safe to share between clients.
+type Recorder struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	start time.Time
+	err   error
+}
+
+// NewRecorder returns a Recorder writing to w. Timestamps are relative to the call to NewRecorder
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		enc:   json.NewEncoder(w),
+		start: time.Now(),
+	}
+}
+
+// Err returns the error which stopped the recording, if writing a frame failed
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Writes a frame to the capture. Frames are dropped once a write failed
+func (r *Recorder) record(dir Direction, messageType int, data []byte) {
+	if r == nil {
+		return
+	}
+	f := Frame{Elapsed: time.Since(r.start), Direction: dir}
+	if messageType == websocket.BinaryMessage {
+		f.Binary = append([]byte{}, data...)
+	} else {
+		f.Text = string(data)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.err = r.enc.Encode(f)
+}
+
+// ReadCapture reads all frames of a capture written by a Recorder
+func ReadCapture(r io.Reader) ([]Frame, error) {
+	frames := []Frame{}
+	dec := json.NewDecoder(r)
+	for {
+		var f Frame
+		if err := dec.Decode(&f); err == io.EOF {
+			return frames, nil
+		} else if err != nil {
+			return nil, err
+		}
+		frames = append(frames, f)
+	}
+}
+
+// Replayer feeds the inbound frames of a capture through the dispatch path of an offline Client, so
+// that a recorded game can be played back into a game without a server
+type Replayer struct {
+	// Offline client dispatching the replayed frames. Register handlers and set its game event
+	// channel before calling Run. Messages it sends are discarded
+	Client *Client
+	// Playback speed relative to the recording. 0 replays the frames as fast as possible
+	Speed float64
+
+	frames []Frame
+}
+
+// NewReplayer reads a capture and returns a Replayer for it. The options select the protocol
+// version the capture was recorded with. If it is not set, it is detected from the handshake in the
+// capture. Nothing is dialed.
+func NewReplayer(r io.Reader, options Options) (*Replayer, error) {
+	frames, err := ReadCapture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Protocol == 0 {
+		options.Protocol = captureProtocol(frames)
+	}
+	c := newClient(options)
+	c.state.transition(StateConnected)
+	return &Replayer{Client: c, frames: frames}, nil
+}
+
+// Returns the protocol version a capture was recorded with. Only Engine.IO v4 clients send the
+// socket.io connect packet themselves
+func captureProtocol(frames []Frame) ProtocolVersion {
+	connect := string(protocol.EncodeMessage(protocol.SocketPacket{Type: protocol.Connect}))
+	for _, f := range frames {
+		if f.Direction == Outbound && f.Text == connect {
+			return EIO4
+		}
+	}
+	return EIO3
+}
+
+// Frames returns the frames of the capture, inbound and outbound
+func (r *Replayer) Frames() []Frame {
+	return r.frames
+}
+
+// Run dispatches the inbound frames in order, then closes the client. It returns early if the
+// client is closed, or with the context's error if the context is done.
+func (r *Replayer) Run(ctx context.Context) error {
+	defer r.Client.Close("Replay finished.")
+
+	start := time.Now()
+	for _, f := range r.frames {
+		if f.Direction != Inbound {
+			continue
+		}
+		if r.Speed > 0 {
+			due := time.Duration(float64(f.Elapsed) / r.Speed)
+			select {
+			case <-time.After(due - time.Since(start)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if r.Client.isClosed() {
+			return nil
+		}
+		r.Client.handleFrame(f.message())
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/client"
+	"github.com/brisberg/generals-io-bot/client/fakeserver"
+)
+
+// Buffer which is safe to write from the client's goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte{}, b.buf.Bytes()...)
+}
+
+// Records a short game against the fake server
+func recordGame(t *testing.T, version client.ProtocolVersion) []byte {
+	t.Helper()
+	s := fakeserver.New()
+	defer s.Close()
+	s.PingInterval = 20 * time.Millisecond
+	s.SetUsername("user1", "[Bot]one")
+
+	out := &syncBuffer{}
+	c := runClient(t, s, client.Options{Protocol: version, Recorder: client.NewRecorder(out)})
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := c.RegisterBot(ctx, "user1", "[Bot]one"); err != nil {
+		t.Fatalf("RegisterBot: %v", err)
+	}
+	// Leave time for a few heartbeats
+	time.Sleep(100 * time.Millisecond)
+
+	s.StartGame(fakeserver.GameStart{PlayerIndex: 0, ReplayID: "replay1", Usernames: []string{"[Bot]one", "other"}})
+	for turn := 1; turn <= 3; turn++ {
+		s.SendUpdate(fakeserver.Update{Turn: turn, Width: 2, Height: 1, Armies: []int{turn, 0}, Terrain: []int{0, -1}, Generals: []int{0, -1}})
+	}
+	s.EndGame(false)
+	select {
+	case <-c.Done():
+	case <-time.After(timeout):
+		t.Fatal("client did not close after the game")
+	}
+	return out.Bytes()
+}
+
+func TestRecorderCapturesHandshake(t *testing.T) {
+	for _, version := range []client.ProtocolVersion{client.EIO3, client.EIO4} {
+		t.Run(fmt.Sprint("EIO", int(version)), func(t *testing.T) {
+			frames, err := client.ReadCapture(bytes.NewReader(recordGame(t, version)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frames) < 3 {
+				t.Fatalf("captured %v frames", len(frames))
+			}
+
+			if f := frames[0]; f.Direction != client.Inbound || !strings.HasPrefix(f.Text, `0{"sid":`) || !strings.Contains(f.Text, "pingInterval") {
+				t.Errorf("first frame = %+v, want the open packet", f)
+			}
+			handshake := frames[1:2]
+			if version == client.EIO4 {
+				if f := frames[1]; f.Direction != client.Outbound || f.Text != "40" {
+					t.Errorf("second frame = %+v, want our connect packet", f)
+				}
+				handshake = frames[2:3]
+			}
+			if f := handshake[0]; f.Direction != client.Inbound || !strings.HasPrefix(f.Text, "40") {
+				t.Errorf("handshake frame = %+v, want the server's connect packet", f)
+			}
+
+			sent := false
+			for i, f := range frames {
+				if i > 0 && f.Elapsed < frames[i-1].Elapsed {
+					t.Errorf("frame %v recorded before the frame preceding it", i)
+				}
+				sent = sent || (f.Direction == client.Outbound && strings.Contains(f.Text, `"get_username"`))
+			}
+			if !sent {
+				t.Error("capture has no get_username request")
+			}
+		})
+	}
+}
+
+func TestReplayer(t *testing.T) {
+	for _, version := range []client.ProtocolVersion{client.EIO3, client.EIO4} {
+		t.Run(fmt.Sprint("EIO", int(version)), func(t *testing.T) {
+			capture := recordGame(t, version)
+
+			// The protocol version is detected from the capture
+			r, err := client.NewReplayer(bytes.NewReader(capture), client.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			events := []string{}
+			r.Client.On(client.AnyEvent, func(raw json.RawMessage) {
+				events = append(events, client.EventName(raw))
+			})
+			if err := r.Run(context.Background()); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			want := "pre_game_start game_start game_update game_update game_update game_lost game_over"
+			if got := strings.Join(events, " "); got != want {
+				t.Errorf("replayed events %q, want %q", got, want)
+			}
+			if r.Client.State() != client.StateClosed {
+				t.Errorf("State() = %v after the replay, want %v", r.Client.State(), client.StateClosed)
+			}
+
+			// Only the EIO4 transport answers the server's pings, with pongs which are never sent
+			pongs := r.Client.OutboxStats()[client.PriorityPing].Depth
+			if (version == client.EIO4) != (pongs > 0) {
+				t.Errorf("replaying an EIO%v capture queued %v pongs", int(version), pongs)
+			}
+		})
+	}
+}
+
+func TestReplayerContext(t *testing.T) {
+	capture := recordGame(t, client.EIO3)
+	r, err := client.NewReplayer(bytes.NewReader(capture), client.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// At a hundredth of the speed the replay takes far longer than the context
+	r.Speed = 0.01
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := r.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
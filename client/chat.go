@@ -0,0 +1,122 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Chat adds sending and receiving messages in lobby and in-game chat rooms.
+package client
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// ChatMessage is a message received in one of the chat rooms we are in
+type ChatMessage struct {
+	// Chat room the message was sent to
+	Room string
+	// Username of the sender, empty for messages from the server
+	Username string
+	// Player index of the sender in the current game or lobby, -1 if unknown
+	PlayerIndex int
+	// Text of the message
+	Text string
+	// True if the message was sent to our team's chat room
+	Team bool
+}
+
+// chatRooms tracks the chat rooms of the game we are playing
+type chatRooms struct {
+	mu   sync.Mutex
+	game string
+	team string
+}
+
+// Returns the chat rooms of the game and of our team
+func (r *chatRooms) rooms() (game, team string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.game, r.team
+}
+
+// Replaces the chat rooms, empty when we are not playing a game
+func (r *chatRooms) set(game, team string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.game, r.team = game, team
+}
+
+// Body of a chat_message event
+type chatMessageData struct {
+	Username    string `json:"username"`
+	Text        string `json:"text"`
+	PlayerIndex *int   `json:"playerIndex"`
+}
+
+// lobbyChatRoom returns the chat room of a custom lobby
+func lobbyChatRoom(lobbyID string) string {
+	return "chat_custom_queue_" + lobbyID
+}
+
+// SendChat sends a message to the chat room of the current game, or of the current custom lobby
+// if we are not playing a game
+func (c *Client) SendChat(text string) error {
+	room, _ := c.chat.rooms()
+	if l := c.Lobby(); room == "" && l != nil {
+		room = lobbyChatRoom(l.ID)
+	}
+	if room == "" {
+		return ErrNotInGame
+	}
+
+	c.sendEvent("chat_message", room, text)
+	return nil
+}
+
+// SendTeamChat sends a message to our team's chat room in the current game
+func (c *Client) SendTeamChat(text string) error {
+	_, team := c.chat.rooms()
+	if team == "" {
+		return ErrNotTeamGame
+	}
+
+	c.sendEvent("chat_message", team, text)
+	return nil
+}
+
+// Records the chat rooms of a game when it starts
+func (c *Client) handleChatGameStart(raw json.RawMessage) {
+	gameinfo := struct {
+		ChatRoom     string `json:"chat_room"`
+		TeamChatRoom string `json:"team_chat_room"`
+	}{}
+	decode := []interface{}{nil, &gameinfo}
+	json.Unmarshal(raw, &decode)
+	c.chat.set(gameinfo.ChatRoom, gameinfo.TeamChatRoom)
+}
+
+// Decodes an incoming chat_message and dispatches it to OnChat and the game
+func (c *Client) handleChatMessage(raw json.RawMessage) {
+	room := ""
+	data := chatMessageData{}
+	decode := []interface{}{nil, &room, &data}
+	if err := json.Unmarshal(raw, &decode); err != nil {
+		return
+	}
+
+	_, team := c.chat.rooms()
+	m := ChatMessage{
+		Room:        room,
+		Username:    data.Username,
+		PlayerIndex: -1,
+		Text:        data.Text,
+		Team:        room != "" && room == team,
+	}
+	if data.PlayerIndex != nil {
+		m.PlayerIndex = *data.PlayerIndex
+	}
+
+	if c.OnChat != nil {
+		c.OnChat(m)
+	}
+	if c.State() == StateInGame {
+		c.forwardGameEvent("chat_message")(raw)
+	}
+}
@@ -2,22 +2,18 @@
 package client
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"log"
-	"strconv"
+	"sync"
 	"time"
 
+	"github.com/brisberg/generals-io-bot/client/protocol"
+	"github.com/brisberg/generals-io-bot/logger"
 	"github.com/gorilla/websocket"
 )
 
 const (
-	// Socket.io packet codes
-	ping      int64  = 2
-	pong      int64  = 3
-	msg       int64  = 42
 	serverPtn string = "ws://%vws.generals.io/socket.io/?EIO=3&transport=websocket"
 )
 
@@ -30,240 +26,478 @@ type NetworkEvent struct {
 
 // Client is a middleman between the websocket connection and client application or bot.
 type Client struct {
-	// The websocket connection.
+	// The websocket connection. Replaced when the client reconnects
 	conn *websocket.Conn
+	// Guards conn while it is being replaced
+	connMu sync.Mutex
+	// Channel closed when the current connection is dropped
+	connDone chan bool
 	// Session ID of current connection
 	sid string
+	// Options the client was connected with, used when redialing
+	options Options
+
+	// Loggers for the client and for every frame
+	log      logger.Logger
+	frameLog logger.Logger
 
 	// Current User object
 	user *User
 
 	// Current Lobby
-	lobby *Lobby
+	lobby   *Lobby
+	lobbyMu sync.Mutex
+
+	// Matchmaking queue we are waiting in
+	queue queueState
 
 	// GameEvents outbound channel for game related network events
 	GameEvents chan<- NetworkEvent
 
-	// Buffered channel of outbound messages.
-	send chan []byte
+	// Game being played and the results of the games played
+	game gameState
+
+	// Continuous play settings. Nil closes the client after the first game
+	Session *Session
+
+	// Prioritised queue of outbound messages
+	outbox *outbox
 
-	// Buffered channel of pong responses
-	pong chan bool
+	// Wire protocol spoken with the server
+	transport transport
+
+	// Buffered channel signalling heartbeats (pongs or pings) received from the server
+	heartbeatc chan bool
 
 	// Channel indicating the connection is closed and we should clean up
 	closed chan bool
 
 	// Callback for when the connection is closed
 	OnClose func()
-}
 
-type connConfig struct {
-	SID          string `json:"sid"` // session ID
-	PingInterval int    `json:"pingInterval"`
-	PingTimeout  int    `json:"pingTimeout"`
+	// Policy for redialing the server when the connection is lost. Nil disables reconnecting
+	ReconnectPolicy *ReconnectPolicy
+
+	// Callback for each reconnect attempt. err is nil if the attempt succeeded
+	OnReconnect func(attempt int, err error)
+
+	// Lifecycle state of the client
+	state *stateMachine
+	// Ensures the client is only shut down once
+	closeOnce sync.Once
+
+	// Chat rooms of the game we are playing
+	chat chatRooms
+
+	// Callback for chat messages received in the lobby or game
+	OnChat func(m ChatMessage)
+
+	// Callback for every change to the custom Lobby we are in
+	OnLobbyUpdate func(l *Lobby)
+
+	// Callback for every error_* event sent by the server
+	OnServerError func(err *ServerError)
+
+	// Registered handlers for inbound socket.io events
+	events *eventRegistry
+
+	// Requests waiting for an acknowledgement from the server
+	acks *ackRegistry
+
+	// Binary attachments of the packet being received
+	attachments protocol.Reassembler
 }
 
 // Connect Connects to the server and returns the connected WebSocket client
 //
 // Server param should be one of "" = US, "es" = Europe, "bot" = Bot (SF) server
-func Connect(server string) (*Client, error) {
-
-	dialer := &websocket.Dialer{}
-	dialer.EnableCompression = false
-	url := fmt.Sprintf(serverPtn, server)
+func Connect(ctx context.Context, server string) (*Client, error) {
+	return ConnectWithOptions(ctx, Options{URL: ServerURL(server)})
+}
 
-	// Dial the server
-	c, _, err := dialer.Dial(url, nil)
+// ConnectWithOptions connects to the server described by the options and returns the connected
+// WebSocket client
+func ConnectWithOptions(ctx context.Context, options Options) (*Client, error) {
+	client := newClient(options)
+	conn, config, err := dial(ctx, &options)
 	if err != nil {
+		client.shutdown(err, "Error Connecting.")
 		return nil, err
 	}
+	client.setConn(conn, config)
+	return client, nil
+}
 
-	// Read connection config from server
-	// Expect msg type to be `0` (open)
-	_, configMsg, err := c.ReadMessage()
-	if err != nil {
-		return nil, err
+// Builds a client which is not connected yet
+func newClient(options Options) *Client {
+	client := &Client{
+		user:       &User{},
+		options:    options,
+		log:        options.logger(),
+		frameLog:   options.frameLogger(),
+		outbox:     newOutbox(options.outboxPolicy()),
+		transport:  options.transport(),
+		heartbeatc: make(chan bool, 1),
+		closed:     make(chan bool),
+		events:     newEventRegistry(),
+		acks:       newAckRegistry(),
+		state:      newStateMachine(),
 	}
-	var msgType int
-	config := connConfig{}
+	client.registerDefaultHandlers()
+	return client
+}
 
-	log.Println("Got: ", string(configMsg))
-	decodeSocketIoMessage(configMsg, msgType, &config)
+// Dials the server and completes the socket.io handshake, giving up when the context is done
+func dial(ctx context.Context, options *Options) (*websocket.Conn, *protocol.Handshake, error) {
+	if _, err := newTransport(options.protocol()); err != nil {
+		return nil, nil, err
+	}
 
-	// Read success message from server
-	// Expect msg type to be `40`
-	_, message, err := c.ReadMessage()
+	// Dial the server
+	c, _, err := options.dialer().DialContext(ctx, options.url(), options.Header)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if string(message) != "40" {
-		return nil, errors.New(fmt.Sprint("Error: Expected '40' success type: got ", msgType))
-	}
-	log.Println("Connection Established.")
+	// Unblock the handshake reads below if the context is done before they complete
+	handshakeDone := make(chan bool)
+	defer close(handshakeDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-handshakeDone:
+		}
+	}()
 
-	user := &User{
-		usernamec: make(chan string, 1),
-		usererrc:  make(chan string, 1),
+	config, err := options.transport().handshake(c, options.Recorder)
+	if err != nil {
+		c.Close()
+		return nil, nil, contextError(ctx, err)
 	}
+	options.logger().Info("Connection established", "sid", config.SID, "protocol", int(options.protocol()))
 
-	client := &Client{
-		conn:   c,
-		user:   user,
-		sid:    config.SID,
-		send:   make(chan []byte, 10),
-		pong:   make(chan bool, 1),
-		closed: make(chan bool),
+	return c, config, nil
+}
+
+// Returns the context's error if it is done, since that is the reason err occurred
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
+	return err
+}
 
-	go client.schedulePingPong(&config)
+// Installs a freshly dialed connection and starts pinging the server over it
+func (c *Client) setConn(conn *websocket.Conn, config *protocol.Handshake) {
+	c.connMu.Lock()
+	c.attachments = protocol.Reassembler{}
+	c.conn = conn
+	c.sid = config.SID
+	c.connDone = make(chan bool)
+	done := c.connDone
+	c.connMu.Unlock()
 
-	return client, nil
+	c.state.transition(StateConnected)
+
+	go c.keepAlive(config, done)
 }
 
-// Set up repeated ping requests to the server
-// Respects the pingInterval and pingTimeout provided by the server when opening the connection
-// If a pong ("3") is not recieved before the timeout, the server is assumed nonresponsive and
-// the connection is closed
-func (c *Client) schedulePingPong(config *connConfig) {
-	ticker := time.NewTicker(time.Duration(config.PingInterval) * time.Millisecond)
-	defer ticker.Stop()
+// Closes the current connection, if any, so that the read loop notices
+func (c *Client) closeCurrentConn() {
+	if conn := c.currentConn(); conn != nil {
+		conn.Close()
+	}
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			// Send a ping
-			c.send <- []byte(strconv.FormatInt(ping, 10) + " ping")
-			timeout := time.After(time.Duration(config.PingTimeout) * time.Millisecond)
-			select {
-			case <-c.pong:
-				// Pong satisfied, do nothing
-			case <-timeout:
-				c.Close("Error Pong Timeout. Connection Lost.")
-				return
-			}
-		case <-c.closed:
-			return
-		}
+// Closes the current connection without closing the client, so that Run can reconnect
+func (c *Client) dropConn() {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	select {
+	case <-c.connDone:
+		// Already dropped
+	default:
+		close(c.connDone)
 	}
+	c.conn.Close()
+}
+
+// Returns the current connection
+func (c *Client) currentConn() *websocket.Conn {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.conn
 }
 
-// Decodes the packet type and the data from a socket.io message
-// TODO: Refactor this to be more flexible to multiplex on the packettype
-func decodeSocketIoMessage(msg []byte, msgType int, data interface{}) error {
-	dec := json.NewDecoder(bytes.NewBuffer(msg))
-	if err := dec.Decode(&msgType); err != nil {
-		return err
+// Returns true once Close has been called
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
 	}
-	var raw json.RawMessage
-	if err := dec.Decode(&raw); err != nil {
-		return err
+}
+
+// Keeps the connection alive using the heartbeat of the transport
+// If the server stops responding, the connection is dropped (or the client closed, if reconnecting
+// is disabled)
+func (c *Client) keepAlive(config *protocol.Handshake, done <-chan bool) {
+	if c.transport.heartbeat(c, config, done) {
+		return
 	}
-	// log.Println(raw)
-	if err := json.Unmarshal(raw, &data); err != nil {
-		return err
+	if c.ReconnectPolicy == nil {
+		c.shutdown(ErrConnectionLost, "Error Pong Timeout. Connection Lost.")
+	} else {
+		c.log.Warn("Pong timeout, dropping connection")
+		c.dropConn()
 	}
-	// log.Println(data)
+}
 
-	return nil
+// Signals the heartbeat that the server is alive
+func (c *Client) notifyHeartbeat() {
+	select {
+	case c.heartbeatc <- true:
+	default:
+	}
 }
 
-// UseGameConstructor sets the constructor the client should use when creating new Game instances
-// func (c *Client) UseGameConstructor(cstr func() IGame) {
-// 	c.newGameCb = cstr
-// }
+// Run Starts the WebSocket server. It returns once the client is closed or the context is done,
+// with the error which closed the client (see Err)
+func (c *Client) Run(ctx context.Context) error {
+	// Close the client when the context is done
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.shutdown(ctx.Err(), fmt.Sprint("Context done: ", ctx.Err()))
+		case <-c.closed:
+		}
+	}()
 
-// Run Starts the WebSocket server
-func (c *Client) Run() error {
 	// Launch goroutine to process outbound requests
 	go func() {
 		time.Sleep(100 * time.Millisecond)
-		for data := range c.send {
-			err := c.conn.WriteMessage(websocket.TextMessage, data)
-			log.Println("Sending: ", string(data))
-			if err != nil {
-				c.Close(fmt.Sprint("Error Sending Request: ", err))
+		for {
+			data, ok := c.outbox.next(c.closed)
+			if !ok {
+				return
+			}
+			err := c.currentConn().WriteMessage(websocket.TextMessage, data)
+			c.frameLog.Debug("Sent frame", "frame", string(data))
+			if err == nil {
+				c.options.Recorder.record(Outbound, websocket.TextMessage, data)
+			} else {
+				if c.ReconnectPolicy == nil {
+					c.shutdown(err, fmt.Sprint("Error Sending Request: ", err))
+				} else {
+					// The read loop will notice the broken connection and reconnect
+					c.log.Warn("Error sending request", "err", err)
+				}
 			}
 		}
 	}()
 
 	// Loop and process inbound responses
 	for {
-		_, message, err := c.conn.ReadMessage()
+		messageType, message, err := c.currentConn().ReadMessage()
 		if err != nil {
-			return err
-		}
-		log.Println("Got: ", string(message))
-		dec := json.NewDecoder(bytes.NewBuffer(message))
-		var msgType int64
-		dec.Decode(&msgType)
-
-		// Dispatch the message to various listeners
-		if msgType == msg {
-			var raw json.RawMessage
-			dec.Decode(&raw)
-			eventname := ""
-			data := []interface{}{&eventname}
-			json.Unmarshal(raw, &data)
-			// log.Println(eventname)
-			// log.Println(data)
-			// if f, ok := c.events[eventname]; ok {
-			// 	f(raw)
-			// }
-			if eventname == "pre_game_start" {
-				c.GameEvents <- NetworkEvent{eventname, raw}
-			} else if eventname == "game_start" {
-				c.GameEvents <- NetworkEvent{eventname, raw}
-			} else if eventname == "game_update" {
-				c.GameEvents <- NetworkEvent{eventname, raw}
-			} else if eventname == "game_over" {
-				c.GameEvents <- NetworkEvent{eventname, raw}
-				c.sendMessage(msg, "leave_game")
-				c.Close("Game concluded.")
-				close(c.GameEvents)
-			} else if eventname == "error_set_username" {
-				// TODO: split this into the user package
-				// Unwrap the error_set_username event and pass back to user
-				data := []string{}
-				json.Unmarshal(raw, &data)
-				c.user.usererrc <- data[1]
+			if c.isClosed() {
+				return c.Err()
+			}
+			if c.ReconnectPolicy == nil {
+				c.shutdown(err, fmt.Sprint("Connection lost: ", err))
+				return c.Err()
+			}
+			if err := c.reconnect(ctx, err); err != nil {
+				c.shutdown(err, fmt.Sprint("Error Reconnecting: ", err))
+				return c.Err()
 			}
-		} else if msgType == pong {
-			c.pong <- true
-		} else if msgType == 430 { // Special 430 code for username response
-			// TODO split this into the user package
-			var raw json.RawMessage
-			dec.Decode(&raw)
-			var name []string
-			json.Unmarshal(raw, &name)
-			c.user.usernamec <- name[0]
+			continue
 		}
+		c.options.Recorder.record(Inbound, messageType, message)
+		c.handleFrame(messageType, message)
 	}
 }
 
-// Sends a message to the GameServer over the WebSocket
-func (c *Client) sendMessage(code int64, v ...interface{}) {
-	buf, _ := json.Marshal(v)
-	newbuf := []byte(strconv.FormatInt(code, 10) + string(buf))
-	c.send <- newbuf
+// Decodes a WebSocket frame and dispatches the packet it carries
+func (c *Client) handleFrame(messageType int, frame []byte) {
+	var p protocol.Packet
+	var err error
+	if messageType == websocket.BinaryMessage {
+		p, err = c.transport.decodeBinary(frame)
+	} else {
+		p, err = protocol.DecodePacket(frame)
+	}
+	if err != nil {
+		c.log.Warn("Error decoding packet", "err", err)
+		return
+	}
+
+	switch p.Type {
+	case protocol.Ping, protocol.Pong:
+		c.frameLog.Debug("Received heartbeat", "type", p.Type)
+		c.transport.handleHeartbeat(c, p)
+	case protocol.Close:
+		c.closeCurrentConn()
+	case protocol.Message:
+		if p.Binary {
+			c.handleAttachment(p.Data)
+			return
+		}
+		sp, err := protocol.DecodeSocketPacket(p.Data)
+		if err != nil {
+			c.log.Warn("Error decoding packet", "err", err)
+			return
+		}
+		c.handleSocketPacket(sp)
+	}
 }
 
-// Close closes the WebSocket connection
-func (c *Client) Close(msg string) {
-	log.Println(msg)
-	log.Println("Closing client connection...")
-	c.conn.Close()
-	close(c.closed)
-	close(c.pong)
+// Dispatches a socket.io packet to the registered handlers or pending requests
+func (c *Client) handleSocketPacket(p protocol.SocketPacket) {
+	switch p.Type {
+	case protocol.Event:
+		name := p.EventName()
+		c.frameLog.Debug("Received event", "event", name, "data", string(p.Data))
+		c.events.dispatch(name, p.Data)
+		if isServerError(name) {
+			c.handleServerError(name, p.Data)
+		}
+	case protocol.Ack:
+		c.frameLog.Debug("Received ack", "id", p.ID, "data", string(p.Data))
+		c.acks.resolve(p.ID, p.Data, nil)
+	case protocol.BinaryEvent, protocol.BinaryAck:
+		c.attachments.Start(p)
+	case protocol.Disconnect:
+		// The server removed us from the namespace, drop the connection so we reconnect
+		c.closeCurrentConn()
+	case protocol.Error:
+		c.log.Warn("Error from server", "data", string(p.Data))
+	}
+}
+
+// Collects a binary attachment, dispatching its packet once all attachments arrived
+func (c *Client) handleAttachment(data []byte) {
+	p, complete, err := c.attachments.Add(data)
+	if err != nil {
+		c.log.Warn("Error decoding attachment", "err", err)
+		return
+	}
+	if complete {
+		// Handle the reassembled packet like its plain counterpart
+		if p.Type == protocol.BinaryEvent {
+			p.Type = protocol.Event
+		} else {
+			p.Type = protocol.Ack
+		}
+		c.handleSocketPacket(p)
+	}
+}
 
-	if c.OnClose != nil {
-		c.OnClose()
+// Registers the handlers the client needs for its own bookkeeping
+func (c *Client) registerDefaultHandlers() {
+	for _, name := range []string{"pre_game_start", "game_start", "game_update", "game_won", "game_lost"} {
+		c.On(name, c.forwardGameEvent(name))
 	}
+	c.On("game_start", func(json.RawMessage) { c.state.transition(StateInGame) })
+	c.On("game_start", c.handleSessionGameStart)
+	c.On("game_start", c.handleQueueGameStart)
+	c.On("game_start", c.handleChatGameStart)
+	c.On("chat_message", c.handleChatMessage)
+	c.On("queue_update", c.handleQueueUpdate)
+	c.On("queue_update", c.handleLobbyUpdate)
+	c.On("game_won", c.handleSessionGameWon)
+	c.On("game_over", c.handleGameOver)
+}
+
+// Returns a handler which forwards the named event to the game instance and the GameEvents channel
+func (c *Client) forwardGameEvent(name string) EventHandler {
+	return func(raw json.RawMessage) {
+		c.dispatchGame(name, raw)
+		if c.GameEvents != nil {
+			c.GameEvents <- NetworkEvent{name, raw}
+		}
+	}
+}
+
+func (c *Client) handleGameOver(raw json.RawMessage) {
+	c.state.transitionFrom(StateRegistered, StateInGame)
+	c.chat.set("", "")
+	c.forwardGameEvent("game_over")(raw)
+	c.sendEvent("leave_game")
+	if c.Session != nil {
+		c.continueSession(c.Session)
+		return
+	}
+	c.Close("Game concluded.")
+	if c.GameEvents != nil {
+		close(c.GameEvents)
+	}
+}
+
+// Queues an event to the GameServer in the outbox of its priority class
+func (c *Client) sendEvent(event string, args ...interface{}) {
+	p, err := protocol.NewEvent(event, args...)
+	if err != nil {
+		c.log.Error("Error encoding event", "event", event, "err", err)
+		return
+	}
+	c.outbox.push(eventPriority(event), coalesceKey(event), protocol.EncodeMessage(p), nil)
+}
+
+// Queues a socket.io packet in the outbox. It is never coalesced. dropped is called if the outbox
+// drops the packet, and may be nil
+func (c *Client) sendSocketPacket(priority Priority, p protocol.SocketPacket, dropped func()) {
+	c.outbox.push(priority, "", protocol.EncodeMessage(p), dropped)
+}
+
+// Queues an Engine.IO packet in the outbox, ahead of everything but moves
+func (c *Client) sendEnginePacket(p protocol.Packet) {
+	c.outbox.push(PriorityPing, "", p.Encode(), nil)
+}
+
+// Close closes the WebSocket connection. It is safe to call from any goroutine, and more than once
+func (c *Client) Close(msg string) {
+	c.shutdown(nil, msg)
+}
+
+// Closes the client, recording err as the terminal error. Only the first call has an effect
+func (c *Client) shutdown(err error, msg string) {
+	c.closeOnce.Do(func() {
+		if err != nil {
+			c.log.Error("Closing client connection", "reason", msg, "err", err)
+		} else {
+			c.log.Info("Closing client connection", "reason", msg)
+		}
+		c.state.mu.Lock()
+		c.state.err = err
+		c.state.mu.Unlock()
+		c.state.transition(StateClosing)
+
+		close(c.closed)
+		if c.currentConn() != nil {
+			c.dropConn()
+		}
+		c.acks.close(ErrConnectionLost)
+		c.state.transition(StateClosed)
+
+		if c.OnClose != nil {
+			c.OnClose()
+		}
+	})
 }
 
 // Attack sends an attack request to the server
 func (c *Client) Attack(from, to int, is50 bool, attackIndex int) {
-	c.sendMessage(msg, "attack", from, to, is50, attackIndex)
+	c.sendEvent("attack", from, to, is50, attackIndex)
+}
+
+// AttackCoord sends an attack request between two cells given by column and row, on a map of the
+// given width
+func (c *Client) AttackCoord(fromX, fromY, toX, toY, width int, is50 bool, attackIndex int) {
+	c.Attack(fromY*width+fromX, toY*width+toX, is50, attackIndex)
 }
 
 // SetGameEventChan saves a channel to the client which will recieve game events
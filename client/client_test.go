@@ -0,0 +1,177 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/client"
+	"github.com/brisberg/generals-io-bot/client/fakeserver"
+	"github.com/brisberg/generals-io-bot/logger"
+)
+
+const timeout = 5 * time.Second
+
+// Game which forwards the events it receives to a channel
+type recordingGame struct {
+	events chan string
+}
+
+func (g *recordingGame) PreGameStart()                 { g.events <- "pre_game_start" }
+func (g *recordingGame) GameStart(raw json.RawMessage) { g.events <- "game_start" }
+func (g *recordingGame) GameUpdate(raw json.RawMessage) {
+	update := struct {
+		Turn int `json:"turn"`
+	}{}
+	decode := []interface{}{nil, &update}
+	json.Unmarshal(raw, &decode)
+	g.events <- fmt.Sprint("game_update ", update.Turn)
+}
+func (g *recordingGame) GameWon()             { g.events <- "game_won" }
+func (g *recordingGame) GameLost()            { g.events <- "game_lost" }
+func (g *recordingGame) GameOver()            { g.events <- "game_over" }
+func (g *recordingGame) NextAttackIndex() int { return 0 }
+
+func TestPlayCustomGame(t *testing.T) {
+	for _, version := range []client.ProtocolVersion{client.EIO3, client.EIO4} {
+		t.Run(fmt.Sprint("EIO", int(version)), func(t *testing.T) {
+			testPlayCustomGame(t, version)
+		})
+	}
+}
+
+func testPlayCustomGame(t *testing.T, version client.ProtocolVersion) {
+	s := fakeserver.New()
+	defer s.Close()
+	s.SetUsername("user1", "[Bot]old")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	c, err := client.ConnectWithOptions(ctx, client.Options{URL: s.URL(), Protocol: version, Logger: logger.Nop()})
+	if err != nil {
+		t.Fatalf("ConnectWithOptions: %v", err)
+	}
+	events := make(chan string, 16)
+	c.UseGameConstructor(func() client.IGame { return &recordingGame{events: events} })
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- c.Run(ctx) }()
+
+	if err := c.RegisterBot(ctx, "user1", "[Bot]new"); err != nil {
+		t.Fatalf("RegisterBot: %v", err)
+	}
+	if got := s.Username("user1"); got != "[Bot]new" {
+		t.Errorf("username on the server = %q, want %q", got, "[Bot]new")
+	}
+	if c.State() != client.StateRegistered {
+		t.Errorf("State() = %v after RegisterBot, want %v", c.State(), client.StateRegistered)
+	}
+
+	if err := c.JoinCustomGame(ctx, "lobby1"); err != nil {
+		t.Fatalf("JoinCustomGame: %v", err)
+	}
+	if l := s.Lobby("lobby1"); l == nil || len(l.UserIDs) != 1 || l.UserIDs[0] != "user1" {
+		t.Errorf("server lobby = %+v, want user1 in it", l)
+	}
+	if c.State() != client.StateInLobby {
+		t.Errorf("State() = %v after JoinCustomGame, want %v", c.State(), client.StateInLobby)
+	}
+
+	if err := c.SetForceStart(true); err != nil {
+		t.Fatalf("SetForceStart: %v", err)
+	}
+	e, err := s.Next("set_force_start", timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lobbyID string
+	var force bool
+	if e.Arg(0, &lobbyID); lobbyID != "lobby1" {
+		t.Errorf("set_force_start lobby = %q, want lobby1", lobbyID)
+	}
+	if e.Arg(1, &force); !force {
+		t.Error("set_force_start force = false, want true")
+	}
+
+	s.StartGame(fakeserver.GameStart{PlayerIndex: 0, ReplayID: "replay1", ChatRoom: "game_1", Usernames: []string{"[Bot]new", "other"}})
+	if err := c.WaitForGameStart(ctx); err != nil {
+		t.Fatalf("WaitForGameStart: %v", err)
+	}
+	expectEvents(t, events, "pre_game_start", "game_start")
+
+	for turn := 1; turn <= 2; turn++ {
+		s.SendUpdate(fakeserver.Update{
+			Turn:     turn,
+			Width:    2,
+			Height:   1,
+			Armies:   []int{turn, 0},
+			Terrain:  []int{0, -1},
+			Generals: []int{0, -1},
+			Scores:   []fakeserver.Score{{Armies: turn, Tiles: 1, Index: 0}, {Armies: 1, Tiles: 1, Index: 1}},
+		})
+	}
+	expectEvents(t, events, "game_update 1", "game_update 2")
+
+	c.Attack(0, 1, false, 1)
+	e, err = s.Next("attack", timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var from, to, attackIndex int
+	var is50 bool
+	e.Arg(0, &from)
+	e.Arg(1, &to)
+	e.Arg(2, &is50)
+	e.Arg(3, &attackIndex)
+	if from != 0 || to != 1 || is50 || attackIndex != 1 {
+		t.Errorf("attack = %v %v %v %v, want 0 1 false 1", from, to, is50, attackIndex)
+	}
+
+	// (1,0) -> (0,0) on the 2 wide map
+	c.AttackCoord(1, 0, 0, 0, 2, true, 2)
+	e, err = s.Next("attack", timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Arg(0, &from)
+	e.Arg(1, &to)
+	e.Arg(2, &is50)
+	e.Arg(3, &attackIndex)
+	if from != 1 || to != 0 || !is50 || attackIndex != 2 {
+		t.Errorf("AttackCoord sent %v %v %v %v, want 1 0 true 2", from, to, is50, attackIndex)
+	}
+
+	s.EndGame(true)
+	expectEvents(t, events, "game_won", "game_over")
+
+	// Without a Session the client closes after the game
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("Run = %v, want nil", err)
+		}
+	case <-time.After(timeout):
+		t.Fatal("Run did not return after the game ended")
+	}
+	if c.State() != client.StateClosed {
+		t.Errorf("State() = %v after the game, want %v", c.State(), client.StateClosed)
+	}
+}
+
+// Fails the test unless the game receives the given events next, in order
+func expectEvents(t *testing.T, events <-chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got != w {
+				t.Fatalf("game received %q, want %q", got, w)
+			}
+		case <-time.After(timeout):
+			t.Fatalf("game did not receive %q", w)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Custom adds configuration of custom game lobbies: game options, teams and host controls.
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// GameSpeeds are the game speeds Generals.io accepts for custom games
+var GameSpeeds = []float64{0.25, 0.5, 0.75, 1, 1.5, 2, 3, 4}
+
+// CustomOptions are changes to the options of a custom Lobby. Nil fields are left unchanged.
+//
+// Sizes and densities are relative values between 0 and 1, as shown by the sliders on Generals.io
+type CustomOptions struct {
+	GameSpeed       *float64 `json:"game_speed,omitempty"`
+	Map             *string  `json:"map,omitempty"`
+	Width           *float64 `json:"width,omitempty"`
+	Height          *float64 `json:"height,omitempty"`
+	CityDensity     *float64 `json:"city_density,omitempty"`
+	MountainDensity *float64 `json:"mountain_density,omitempty"`
+	SwampDensity    *float64 `json:"swamp_density,omitempty"`
+	// IDs of the game modifiers to enable. Nil leaves the modifiers unchanged, an empty slice
+	// disables all of them
+	Modifiers *[]int `json:"modifiers,omitempty"`
+}
+
+// Float returns a pointer to v, for filling in CustomOptions
+func Float(v float64) *float64 {
+	return &v
+}
+
+// String returns a pointer to s, for filling in CustomOptions
+func String(s string) *string {
+	return &s
+}
+
+// Ints returns a pointer to a slice of the values, for filling in CustomOptions. Without values it
+// returns an empty slice, which disables all modifiers
+func Ints(v ...int) *[]int {
+	if v == nil {
+		v = []int{}
+	}
+	return &v
+}
+
+// Returns true if the lobby's options include every change
+func (o CustomOptions) appliedTo(l *Lobby) bool {
+	opts := l.Options()
+	equal := func(want *float64, got float64) bool {
+		return want == nil || *want == got
+	}
+	if !equal(o.GameSpeed, opts.GameSpeed) || !equal(o.Width, opts.Width) ||
+		!equal(o.Height, opts.Height) || !equal(o.CityDensity, opts.CityDensity) ||
+		!equal(o.MountainDensity, opts.MountainDensity) || !equal(o.SwampDensity, opts.SwampDensity) {
+		return false
+	}
+	if o.Map != nil && *o.Map != l.MapTitle() {
+		return false
+	}
+	if o.Modifiers != nil && !sameSet(*o.Modifiers, opts.Modifiers) {
+		return false
+	}
+	return true
+}
+
+// Returns true if both slices hold the same values, in any order
+func sameSet(a, b []int) bool {
+	count := make(map[int]int, len(a))
+	for _, v := range a {
+		count[v]++
+	}
+	for _, v := range b {
+		count[v]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Validates the options before sending them to the server
+func (o CustomOptions) validate() error {
+	if o.GameSpeed != nil {
+		valid := false
+		for _, speed := range GameSpeeds {
+			valid = valid || *o.GameSpeed == speed
+		}
+		if !valid {
+			return fmt.Errorf("%w: game speed %v must be one of %v", ErrInvalidOption, *o.GameSpeed, GameSpeeds)
+		}
+	}
+	relative := map[string]*float64{
+		"width":            o.Width,
+		"height":           o.Height,
+		"city density":     o.CityDensity,
+		"mountain density": o.MountainDensity,
+		"swamp density":    o.SwampDensity,
+	}
+	for name, v := range relative {
+		if v != nil && (*v < 0 || *v > 1) {
+			return fmt.Errorf("%w: %v %v must be between 0 and 1", ErrInvalidOption, name, *v)
+		}
+	}
+	return nil
+}
+
+// IsHost returns true if we are the host of the lobby. The host is the player at index 0
+func (l *Lobby) IsHost() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.usernames) > 0 && l.lobbyIndex == 0
+}
+
+// Returns the current Lobby if we are its host
+func (c *Client) hostedLobby() (*Lobby, error) {
+	l := c.Lobby()
+	if l == nil {
+		return nil, ErrNotInLobby
+	}
+	if !l.IsHost() {
+		return nil, ErrNotHost
+	}
+	return l, nil
+}
+
+// SetCustomOptions changes the options of the custom Lobby we are hosting.
+// It blocks until the server sends the next lobby update, and returns the options the server
+// applied, which may differ from the request if the server adjusted a value. If the lobby already
+// has the requested options it returns them without waiting.
+func (c *Client) SetCustomOptions(ctx context.Context, options CustomOptions) (GameOptions, error) {
+	l, err := c.hostedLobby()
+	if err != nil {
+		return GameOptions{}, err
+	}
+	if err := options.validate(); err != nil {
+		return GameOptions{}, err
+	}
+
+	w := c.expect("queue_update").failOn(ErrCustomGame, ErrBanned)
+	c.sendEvent("set_custom_options", l.ID, options)
+	// The server may not send an update for options which are already set
+	if options.appliedTo(l) {
+		w.cancel()
+		return l.Options(), nil
+	}
+	if _, err := w.wait(ctx); err != nil {
+		return GameOptions{}, fmt.Errorf("Error: Could not set custom options: %w", err)
+	}
+	return l.Options(), nil
+}
+
+// SetGameSpeed changes the game speed of the custom Lobby we are hosting
+func (c *Client) SetGameSpeed(ctx context.Context, speed float64) (GameOptions, error) {
+	return c.SetCustomOptions(ctx, CustomOptions{GameSpeed: Float(speed)})
+}
+
+// SetMap changes the custom map of the Lobby we are hosting. An empty title uses a random map
+func (c *Client) SetMap(ctx context.Context, title string) (GameOptions, error) {
+	return c.SetCustomOptions(ctx, CustomOptions{Map: String(title)})
+}
+
+// SetTeam moves us to the given team in the current custom Lobby.
+// It blocks until the server sends the updated lobby.
+func (c *Client) SetTeam(ctx context.Context, team int) error {
+	l := c.Lobby()
+	if l == nil {
+		return ErrNotInLobby
+	}
+
+	w := c.expect("queue_update").failOn(ErrCustomGame, ErrBanned)
+	c.sendEvent("set_custom_team", l.ID, team)
+	if _, err := w.wait(ctx); err != nil {
+		return fmt.Errorf("Error: Could not change to team %v: %w", team, err)
+	}
+	return nil
+}
+
+// TransferHost makes the player with the given lobby index the host of the Lobby we are hosting.
+// It blocks until the server sends the updated lobby.
+func (c *Client) TransferHost(ctx context.Context, playerIndex int) error {
+	l, err := c.hostedLobby()
+	if err != nil {
+		return err
+	}
+
+	w := c.expect("queue_update").failOn(ErrCustomGame, ErrBanned)
+	c.sendEvent("set_custom_host", l.ID, playerIndex)
+	if _, err := w.wait(ctx); err != nil {
+		return fmt.Errorf("Error: Could not transfer host to player %v: %w", playerIndex, err)
+	}
+	return nil
+}
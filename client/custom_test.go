@@ -0,0 +1,119 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/client"
+	"github.com/brisberg/generals-io-bot/client/fakeserver"
+)
+
+// Connects a client which hosts the custom lobby "lobby1"
+func hostLobby(t *testing.T, s *fakeserver.Server) *client.Client {
+	t.Helper()
+	s.SetUsername("user1", "[Bot]host")
+	c := runClient(t, s, client.Options{})
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := c.RegisterBot(ctx, "user1", "[Bot]host"); err != nil {
+		t.Fatalf("RegisterBot: %v", err)
+	}
+	if err := c.JoinCustomGame(ctx, "lobby1"); err != nil {
+		t.Fatalf("JoinCustomGame: %v", err)
+	}
+	if !c.Lobby().IsHost() {
+		t.Fatal("IsHost() = false for the only player")
+	}
+	return c
+}
+
+// Calls SetCustomOptions without a deadline, failing the test if it does not return
+func setOptions(t *testing.T, c *client.Client, options client.CustomOptions) (client.GameOptions, error) {
+	t.Helper()
+	type result struct {
+		opts client.GameOptions
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		opts, err := c.SetCustomOptions(context.Background(), options)
+		done <- result{opts, err}
+	}()
+	select {
+	case r := <-done:
+		return r.opts, r.err
+	case <-time.After(timeout):
+		t.Fatal("SetCustomOptions did not return")
+	}
+	return client.GameOptions{}, nil
+}
+
+func TestSetCustomOptions(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	c := hostLobby(t, s)
+
+	opts, err := setOptions(t, c, client.CustomOptions{GameSpeed: client.Float(2), Width: client.Float(0.5), Modifiers: client.Ints(1, 3)})
+	if err != nil {
+		t.Fatalf("SetCustomOptions: %v", err)
+	}
+	if opts.GameSpeed != 2 || opts.Width != 0.5 || !reflect.DeepEqual(opts.Modifiers, []int{1, 3}) {
+		t.Errorf("SetCustomOptions = %+v", opts)
+	}
+
+	// Clearing the modifiers sends an empty list
+	opts, err = setOptions(t, c, client.CustomOptions{Modifiers: client.Ints()})
+	if err != nil || len(opts.Modifiers) != 0 {
+		t.Errorf("SetCustomOptions clearing modifiers = %+v, %v", opts, err)
+	}
+	if l := s.Lobby("lobby1"); !reflect.DeepEqual(l.Options["modifiers"], []interface{}{}) {
+		t.Errorf("server modifiers = %v, want []", l.Options["modifiers"])
+	}
+
+	if _, err := setOptions(t, c, client.CustomOptions{GameSpeed: client.Float(5)}); !errors.Is(err, client.ErrInvalidOption) {
+		t.Errorf("SetCustomOptions with an invalid speed = %v, want %v", err, client.ErrInvalidOption)
+	}
+}
+
+func TestSetCustomOptionsAlreadySet(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	c := hostLobby(t, s)
+	if _, err := setOptions(t, c, client.CustomOptions{GameSpeed: client.Float(2), Modifiers: client.Ints(1, 3)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server does not answer options which are already set
+	s.Handle("set_custom_options", func(*fakeserver.Conn, fakeserver.Event) {})
+	opts, err := setOptions(t, c, client.CustomOptions{GameSpeed: client.Float(2), Modifiers: client.Ints(3, 1)})
+	if err != nil || opts.GameSpeed != 2 {
+		t.Errorf("SetCustomOptions = %+v, %v", opts, err)
+	}
+}
+
+func TestSetCustomOptionsReturnsAppliedOptions(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	c := hostLobby(t, s)
+
+	// The server clamps the width and reorders the modifiers
+	s.Handle("set_custom_options", func(conn *fakeserver.Conn, e fakeserver.Event) {
+		conn.Emit("queue_update", map[string]interface{}{
+			"options":       map[string]interface{}{"width": 0.9, "modifiers": []int{3, 1}},
+			"lobbyIndex":    0,
+			"playerIndices": []int{0},
+			"usernames":     []string{"[Bot]host"},
+			"teams":         []int{1},
+		})
+	})
+	opts, err := setOptions(t, c, client.CustomOptions{Width: client.Float(1), Modifiers: client.Ints(1, 3)})
+	if err != nil {
+		t.Fatalf("SetCustomOptions: %v", err)
+	}
+	if opts.Width != 0.9 || !reflect.DeepEqual(opts.Modifiers, []int{3, 1}) {
+		t.Errorf("SetCustomOptions = %+v, want the clamped width and the server's modifiers", opts)
+	}
+}
@@ -0,0 +1,134 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Errors adds the errors returned by the client, and the mapping of the server's error_* events to
+// them. Use errors.Is to test for them, since they are usually wrapped with more detail.
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors for requests which are invalid in the client's current state
+var (
+	// ErrClientClosed is returned by blocking operations when the client is closed before they complete
+	ErrClientClosed = errors.New("Error: Client closed")
+	// ErrMissingCredentials is returned when registering without a userID or username
+	ErrMissingCredentials = errors.New("Error: Must specify both a userID and a username")
+	// ErrNotInLobby is returned by lobby requests when we are not in a custom Lobby
+	ErrNotInLobby = errors.New("Error: Not in a Lobby. Try joining a game first")
+	// ErrNotInQueue is returned by queue requests when we are not in a matchmaking queue
+	ErrNotInQueue = errors.New("Error: Not in a queue. Try joining a queue first")
+	// ErrNotInGame is returned by game requests when we are not in a game or Lobby
+	ErrNotInGame = errors.New("Error: Not in a game or Lobby. Try joining a game first")
+	// ErrNotTeamGame is returned when chatting with our team outside of a team game
+	ErrNotTeamGame = errors.New("Error: Not in a team game")
+	// ErrNotHost is returned when configuring a Lobby we are not the host of
+	ErrNotHost = errors.New("Error: Only the host can configure the Lobby")
+	// ErrMissingTeamID is returned when joining the 2v2 queue without a team
+	ErrMissingTeamID = errors.New("Error: Must specify a team ID to join the 2v2 queue")
+	// ErrForceStart1v1 is returned when voting to force start in the 1v1 queue
+	ErrForceStart1v1 = errors.New("Error: Can't force start a game in the 1v1 queue")
+	// ErrInvalidOption is returned for custom game options the server does not accept
+	ErrInvalidOption = errors.New("Error: Invalid custom game option")
+)
+
+// Errors reported by the server with error_* events
+var (
+	// ErrUsernameTaken means the username belongs to another user
+	ErrUsernameTaken = errors.New("Error: Username is taken")
+	// ErrInvalidUsername means the username was rejected, for example for not starting with [Bot]
+	ErrInvalidUsername = errors.New("Error: Invalid username")
+	// ErrUsernameLocked means the user already has a different username, which can not be changed
+	ErrUsernameLocked = errors.New("Error: Username can not be changed")
+	// ErrInvalidUserID means the server does not accept the userID
+	ErrInvalidUserID = errors.New("Error: Invalid user ID")
+	// ErrBanned means the user or connection is banned
+	ErrBanned = errors.New("Error: Banned")
+	// ErrQueue means a matchmaking queue request failed
+	ErrQueue = errors.New("Error: Queue request failed")
+	// ErrCustomGame means a custom game request failed
+	ErrCustomGame = errors.New("Error: Custom game request failed")
+	// ErrServer is any other error reported by the server
+	ErrServer = errors.New("Error: Server error")
+)
+
+// ServerError is an error_* event sent by the server. It wraps one of the server errors above
+type ServerError struct {
+	// Name of the event, such as error_set_username
+	Event string
+	// Message sent by the server
+	Message string
+	// Sentinel error the event maps to
+	Err error
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("%v: %v (%v)", e.Err, e.Message, e.Event)
+}
+
+// Unwrap returns the sentinel error the event maps to
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// Returns true if the event reports an error
+func isServerError(event string) bool {
+	return strings.HasPrefix(event, "error_")
+}
+
+// Decodes an error_* event. The message is the first argument if it is a string, or its JSON
+func newServerError(event string, raw json.RawMessage) *ServerError {
+	args := []json.RawMessage{}
+	json.Unmarshal(raw, &args)
+	message := ""
+	if len(args) > 1 {
+		if err := json.Unmarshal(args[1], &message); err != nil {
+			message = string(args[1])
+		}
+	}
+	return &ServerError{Event: event, Message: message, Err: serverErrorKind(event, message)}
+}
+
+// Maps an error event to a sentinel error by its name and message
+func serverErrorKind(event, message string) error {
+	lower := strings.ToLower(message)
+	switch {
+	case event == "error_banned" || strings.Contains(lower, "banned"):
+		return ErrBanned
+	case event == "error_user_id" || strings.Contains(lower, "user id"):
+		return ErrInvalidUserID
+	case event == "error_set_username":
+		switch {
+		case strings.Contains(lower, "taken"):
+			return ErrUsernameTaken
+		case strings.Contains(lower, "already") || strings.Contains(lower, "change"):
+			return ErrUsernameLocked
+		}
+		return ErrInvalidUsername
+	case strings.HasPrefix(event, "error_queue") || strings.Contains(lower, "queue"):
+		return ErrQueue
+	case strings.HasPrefix(event, "error_custom") || strings.HasPrefix(event, "error_private") ||
+		strings.Contains(lower, "custom"):
+		return ErrCustomGame
+	}
+	return ErrServer
+}
+
+// Reports an error event to OnServerError and fails the requests waiting for a reply which are
+// affected by errors of its kind, except those waiting for this very event
+func (c *Client) handleServerError(event string, raw json.RawMessage) {
+	err := newServerError(event, raw)
+	if event == "error_set_username" && err.Message == "" {
+		// An empty error is the server's way of confirming the username change
+		return
+	}
+
+	c.log.Warn("Error from server", "event", event, "message", err.Message)
+	if c.OnServerError != nil {
+		c.OnServerError(err)
+	}
+	c.events.failWaiters(event, err)
+}
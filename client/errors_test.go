@@ -0,0 +1,53 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestServerErrorKind(t *testing.T) {
+	tests := []struct {
+		event   string
+		message string
+		want    error
+	}{
+		{"error_banned", "", ErrBanned},
+		{"error_queue", "You have been BANNED.", ErrBanned},
+		{"error_user_id", "", ErrInvalidUserID},
+		{"error_join", "Invalid user ID.", ErrInvalidUserID},
+		{"error_set_username", "This username is already taken.", ErrUsernameTaken},
+		{"error_set_username", "You already have a username.", ErrUsernameLocked},
+		{"error_set_username", "You can't change your username.", ErrUsernameLocked},
+		{"error_set_username", "Bot usernames must start with [Bot].", ErrInvalidUsername},
+		{"error_queue_full", "", ErrQueue},
+		{"error_join", "The queue is closed.", ErrQueue},
+		{"error_custom_options", "", ErrCustomGame},
+		{"error_private", "", ErrCustomGame},
+		{"error_join", "Custom game not found.", ErrCustomGame},
+		{"error_join", "Something went wrong.", ErrServer},
+		{"error_unknown", "", ErrServer},
+	}
+	for _, tt := range tests {
+		if got := serverErrorKind(tt.event, tt.message); got != tt.want {
+			t.Errorf("serverErrorKind(%q, %q) = %v, want %v", tt.event, tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestNewServerError(t *testing.T) {
+	tests := []struct {
+		raw     string
+		message string
+	}{
+		{`["error_queue_full","The queue is full."]`, "The queue is full."},
+		{`["error_queue_full",{"reason":"full"}]`, `{"reason":"full"}`},
+		{`["error_queue_full"]`, ""},
+	}
+	for _, tt := range tests {
+		err := newServerError("error_queue_full", json.RawMessage(tt.raw))
+		if err.Event != "error_queue_full" || err.Message != tt.message || !errors.Is(err, ErrQueue) {
+			t.Errorf("newServerError(%s) = %+v, want message %q", tt.raw, err, tt.message)
+		}
+	}
+}
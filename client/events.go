@@ -0,0 +1,210 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Events adds a registry of handlers which are called for socket.io events received from Generals.io.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/brisberg/generals-io-bot/client/protocol"
+)
+
+// AnyEvent is the wildcard event name. Handlers registered for it are called for every event
+const AnyEvent = "*"
+
+// EventHandler is called with the raw JSON array of a socket.io event.
+// The first element of the array is the event name, the remaining elements are the event arguments.
+type EventHandler func(data json.RawMessage)
+
+// HandlerID identifies a registered EventHandler so that it can be removed later
+type HandlerID uint64
+
+type registeredHandler struct {
+	id      HandlerID
+	handler EventHandler
+}
+
+// eventRegistry holds all of the handlers registered on a Client, keyed by event name
+type eventRegistry struct {
+	mu       sync.RWMutex
+	lastID   HandlerID
+	handlers map[string][]registeredHandler
+	// Waiters which are failed by server errors of the kinds they registered for
+	waiters map[*eventWaiter]struct{}
+}
+
+func newEventRegistry() *eventRegistry {
+	return &eventRegistry{
+		handlers: make(map[string][]registeredHandler),
+		waiters:  make(map[*eventWaiter]struct{}),
+	}
+}
+
+// On registers a handler for the named event and returns an ID which can be passed to Off.
+//
+// Use AnyEvent as the name to receive every event. Handlers are called in the order they were
+// registered on the goroutine running Client.Run, specific handlers before wildcard handlers.
+func (c *Client) On(event string, handler EventHandler) HandlerID {
+	r := c.events
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	r.handlers[event] = append(r.handlers[event], registeredHandler{r.lastID, handler})
+	return r.lastID
+}
+
+// Off removes a previously registered handler. It returns false if no handler had the given ID
+func (c *Client) Off(id HandlerID) bool {
+	r := c.events
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for event, handlers := range r.handlers {
+		for i, h := range handlers {
+			if h.id != id {
+				continue
+			}
+			// Copy so dispatches already in progress keep their own slice
+			remaining := make([]registeredHandler, 0, len(handlers)-1)
+			remaining = append(remaining, handlers[:i]...)
+			remaining = append(remaining, handlers[i+1:]...)
+			if len(remaining) == 0 {
+				delete(r.handlers, event)
+			} else {
+				r.handlers[event] = remaining
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch calls every handler registered for the event, followed by the wildcard handlers
+func (r *eventRegistry) dispatch(event string, raw json.RawMessage) {
+	r.mu.RLock()
+	specific := r.handlers[event]
+	wildcard := r.handlers[AnyEvent]
+	r.mu.RUnlock()
+
+	for _, h := range specific {
+		h.handler(raw)
+	}
+	if event == AnyEvent {
+		return
+	}
+	for _, h := range wildcard {
+		h.handler(raw)
+	}
+}
+
+// eventWaiter receives the first of a set of events. It is created before sending the request
+// which causes the events, so that a fast reply can not be missed.
+type eventWaiter struct {
+	c        *Client
+	names    []string
+	ids      []HandlerID
+	received chan NetworkEvent
+	failed   chan error
+	// Kinds of server errors which fail the wait, such as ErrQueue
+	kinds []error
+}
+
+// Starts listening for the first of the named events
+func (c *Client) expect(names ...string) *eventWaiter {
+	w := &eventWaiter{
+		c:        c,
+		names:    names,
+		received: make(chan NetworkEvent, 1),
+		failed:   make(chan error, 1),
+	}
+	for _, name := range names {
+		name := name
+		w.ids = append(w.ids, c.On(name, func(raw json.RawMessage) {
+			select {
+			case w.received <- NetworkEvent{name, raw}:
+			default:
+			}
+		}))
+	}
+	return w
+}
+
+// Blocks until one of the events is received, the client is closed or the context is done
+func (w *eventWaiter) wait(ctx context.Context) (NetworkEvent, error) {
+	defer w.cancel()
+
+	select {
+	case evt := <-w.received:
+		return evt, nil
+	case err := <-w.failed:
+		return NetworkEvent{}, err
+	case <-w.c.closed:
+		return NetworkEvent{}, ErrClientClosed
+	case <-ctx.Done():
+		return NetworkEvent{}, ctx.Err()
+	}
+}
+
+// Stops listening for the events
+func (w *eventWaiter) cancel() {
+	for _, id := range w.ids {
+		w.c.Off(id)
+	}
+	w.c.events.mu.Lock()
+	delete(w.c.events.waiters, w)
+	w.c.events.mu.Unlock()
+}
+
+// Makes server errors of the given kinds, which are reported while waiting, fail the wait
+func (w *eventWaiter) failOn(kinds ...error) *eventWaiter {
+	w.kinds = kinds
+	w.c.events.mu.Lock()
+	w.c.events.waiters[w] = struct{}{}
+	w.c.events.mu.Unlock()
+	return w
+}
+
+// Fails the waiters registered for the kind of the error, except those waiting for the event itself
+func (r *eventRegistry) failWaiters(event string, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for w := range r.waiters {
+		if w.expects(event) || !w.failsOn(err) {
+			continue
+		}
+		select {
+		case w.failed <- err:
+		default:
+		}
+	}
+}
+
+// Returns true if the error is of one of the kinds the waiter registered for
+func (w *eventWaiter) failsOn(err error) bool {
+	for _, kind := range w.kinds {
+		if errors.Is(err, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the waiter is waiting for the named event
+func (w *eventWaiter) expects(event string) bool {
+	for _, name := range w.names {
+		if name == event {
+			return true
+		}
+	}
+	return false
+}
+
+// EventName returns the name of a socket.io event from its raw JSON array
+func EventName(raw json.RawMessage) string {
+	return protocol.SocketPacket{Type: protocol.Event, Data: raw}.EventName()
+}
@@ -0,0 +1,636 @@
+// Package fakeserver implements an in-process stand-in for the Generals.io socket.io server.
+//
+// It speaks the same Engine.IO v3 / socket.io framing the client expects (or Engine.IO v4 when dialed
+// with EIO=4), scripts lobbies and games, and records every event a bot sends so tests can assert on
+// them without any network access.
+package fakeserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/client/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// Server is a fake Generals.io server listening on a local port
+type Server struct {
+	// Interval and timeout advertised to clients in the open packet
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu sync.Mutex
+	// Open connections, in connection order
+	conns []*Conn
+	// Number of connections accepted so far, used to generate session IDs
+	numConns int
+	// Username registered for each user ID
+	usernames map[string]string
+	// Custom lobbies by ID
+	lobbies map[string]*Lobby
+	// User IDs waiting in each matchmaking queue, keyed by queue name
+	queues map[string][]string
+	// Custom handlers which replace the built in behaviour for an event
+	handlers map[string]func(*Conn, Event)
+	// Every event received from a client, in order
+	received []Event
+	// Index of the next event to return from Next, per event name
+	cursors map[string]int
+	// Closed and replaced whenever a new event is recorded
+	notify chan struct{}
+}
+
+// Event is a socket.io event received from a client
+type Event struct {
+	// Session ID of the connection which sent the event
+	SID string
+	// Name of the event
+	Name string
+	// Remaining arguments of the event
+	Args []json.RawMessage
+	// Acknowledgement ID of the packet, or -1 if the client does not expect a reply
+	AckID int
+}
+
+// Arg decodes the i-th argument of the event into v
+func (e Event) Arg(i int, v interface{}) error {
+	if i >= len(e.Args) {
+		return fmt.Errorf("Error: Event %v has no argument %v", e.Name, i)
+	}
+	return json.Unmarshal(e.Args[i], v)
+}
+
+// Lobby is the state of a custom lobby on the fake server
+type Lobby struct {
+	ID string
+	// User IDs of the players in the lobby, in join order. The first player is the host
+	UserIDs []string
+	// User IDs of the players voting to force start
+	Forcing map[string]bool
+	// Team chosen by each player. Players who did not choose are on their own team
+	Teams map[string]int
+	// Custom game options set by the host, as sent by the client
+	Options map[string]interface{}
+	// Title of the custom map set by the host
+	MapTitle string
+}
+
+// New starts a fake server on a local port
+func New() *Server {
+	s := &Server{
+		PingInterval: 25 * time.Second,
+		PingTimeout:  60 * time.Second,
+		usernames:    make(map[string]string),
+		lobbies:      make(map[string]*Lobby),
+		queues:       make(map[string][]string),
+		handlers:     make(map[string]func(*Conn, Event)),
+		cursors:      make(map[string]int),
+		notify:       make(chan struct{}),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveWS))
+	return s
+}
+
+// URL returns the WebSocket URL clients should dial
+func (s *Server) URL() string {
+	return "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/socket.io/?EIO=3&transport=websocket"
+}
+
+// Close disconnects all clients and stops the server
+func (s *Server) Close() {
+	s.DropConnections()
+	s.srv.Close()
+}
+
+// DropConnections closes every open connection, simulating a network failure
+func (s *Server) DropConnections() {
+	for _, c := range s.Conns() {
+		c.Close()
+	}
+}
+
+// Conns returns the open connections, in connection order
+func (s *Server) Conns() []*Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Conn(nil), s.conns...)
+}
+
+// SetUsername registers a username for a user ID, as if it had been set previously
+func (s *Server) SetUsername(userID, username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usernames[userID] = username
+}
+
+// Username returns the username registered for a user ID
+func (s *Server) Username(userID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usernames[userID]
+}
+
+// Lobby returns a copy of the custom lobby with the given ID, or nil if nobody joined it
+func (s *Server) Lobby(ID string) *Lobby {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.lobbies[ID]
+	if !ok {
+		return nil
+	}
+	cp := newLobby(l.ID)
+	cp.UserIDs = append(cp.UserIDs, l.UserIDs...)
+	cp.MapTitle = l.MapTitle
+	for id, f := range l.Forcing {
+		cp.Forcing[id] = f
+	}
+	for id, t := range l.Teams {
+		cp.Teams[id] = t
+	}
+	for k, v := range l.Options {
+		cp.Options[k] = v
+	}
+	return cp
+}
+
+func newLobby(ID string) *Lobby {
+	return &Lobby{
+		ID:      ID,
+		Forcing: make(map[string]bool),
+		Teams:   make(map[string]int),
+		Options: make(map[string]interface{}),
+	}
+}
+
+// Handle replaces the built in behaviour of the server for an event.
+// Events are still recorded before the handler is called.
+func (s *Server) Handle(event string, handler func(c *Conn, e Event)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[event] = handler
+}
+
+// Received returns every recorded event with the given name. An empty name returns all events
+func (s *Server) Received(name string) []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := []Event{}
+	for _, e := range s.received {
+		if name == "" || e.Name == name {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Next returns the oldest event with the given name which has not been returned by Next yet,
+// waiting up to timeout for the client to send it
+func (s *Server) Next(name string, timeout time.Duration) (Event, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		for i := s.cursors[name]; i < len(s.received); i++ {
+			if s.received[i].Name == name {
+				s.cursors[name] = i + 1
+				e := s.received[i]
+				s.mu.Unlock()
+				return e, nil
+			}
+		}
+		s.cursors[name] = len(s.received)
+		notify := s.notify
+		s.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return Event{}, fmt.Errorf("Error: Timed out waiting for %v event", name)
+		}
+	}
+}
+
+// Emit sends an event to every open connection
+func (s *Server) Emit(event string, args ...interface{}) {
+	for _, c := range s.Conns() {
+		c.Emit(event, args...)
+	}
+}
+
+// Upgrades an HTTP request and serves the socket.io session until the connection closes
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.numConns++
+	c := &Conn{s: s, ws: ws, sid: "fake-sid-" + strconv.Itoa(s.numConns)}
+	s.conns = append(s.conns, c)
+	s.mu.Unlock()
+	defer s.removeConn(c)
+
+	open := protocol.EncodeHandshake(protocol.Handshake{
+		SID:          c.sid,
+		PingInterval: int(s.PingInterval / time.Millisecond),
+		PingTimeout:  int(s.PingTimeout / time.Millisecond),
+	})
+	if c.write(open) != nil {
+		return
+	}
+	if r.URL.Query().Get("EIO") == "4" {
+		// The client connects to the default namespace, and the server sends the pings
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if p, err := protocol.DecodeMessage(data); err != nil || p.Type != protocol.Connect {
+			return
+		}
+		payload, _ := json.Marshal(map[string]string{"sid": c.sid})
+		if c.write(protocol.EncodeMessage(protocol.SocketPacket{Type: protocol.Connect, Data: payload})) != nil {
+			return
+		}
+		go s.sendPings(c)
+	} else if c.write(protocol.EncodeMessage(protocol.SocketPacket{Type: protocol.Connect})) != nil {
+		return
+	}
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.handlePacket(c, data)
+	}
+}
+
+// Pings an Engine.IO v4 client every PingInterval until the connection closes
+func (s *Server) sendPings(c *Conn) {
+	ticker := time.NewTicker(s.PingInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if c.write(protocol.Packet{Type: protocol.Ping}.Encode()) != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) removeConn(c *Conn) {
+	c.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, o := range s.conns {
+		if o == c {
+			s.conns = append(s.conns[:i], s.conns[i+1:]...)
+			return
+		}
+	}
+}
+
+// Handles a single Engine.IO packet from a client
+func (s *Server) handlePacket(c *Conn, frame []byte) {
+	p, err := protocol.DecodePacket(frame)
+	if err != nil {
+		return
+	}
+	switch p.Type {
+	case protocol.Ping:
+		// Engine.IO v3 ping, reply with a pong carrying the same payload
+		c.write(protocol.Packet{Type: protocol.Pong, Data: p.Data}.Encode())
+	case protocol.Message:
+		sp, err := protocol.DecodeSocketPacket(p.Data)
+		if err != nil || sp.Type != protocol.Event {
+			return
+		}
+		e := Event{SID: c.sid, Name: sp.EventName(), Args: sp.Args(), AckID: -1}
+		if sp.HasID {
+			e.AckID = sp.ID
+		}
+		s.record(e)
+
+		s.mu.Lock()
+		handler, ok := s.handlers[e.Name]
+		s.mu.Unlock()
+		if ok {
+			handler(c, e)
+		} else {
+			s.handleBuiltin(c, e)
+		}
+	}
+}
+
+// Records an event and wakes up anyone waiting in Next
+func (s *Server) record(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, e)
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// Built in behaviour of the server for the events the client sends
+func (s *Server) handleBuiltin(c *Conn, e Event) {
+	switch e.Name {
+	case "get_username":
+		var userID string
+		e.Arg(0, &userID)
+		c.Ack(e.AckID, s.Username(userID))
+	case "set_username":
+		var userID, username string
+		e.Arg(0, &userID)
+		e.Arg(1, &username)
+		s.SetUsername(userID, username)
+		c.Emit("error_set_username", "")
+	case "join_private":
+		var lobbyID, userID string
+		e.Arg(0, &lobbyID)
+		e.Arg(1, &userID)
+		c.setUserID(userID)
+		s.joinLobby(lobbyID, userID)
+		s.sendQueueUpdate(lobbyID)
+	case "set_force_start":
+		var lobbyID string
+		var force bool
+		e.Arg(0, &lobbyID)
+		e.Arg(1, &force)
+		s.mu.Lock()
+		if l, ok := s.lobbies[lobbyID]; ok {
+			l.Forcing[c.UserID()] = force
+		}
+		s.mu.Unlock()
+		s.sendQueueUpdate(lobbyID)
+	case "set_custom_options":
+		var lobbyID string
+		options := map[string]interface{}{}
+		e.Arg(0, &lobbyID)
+		e.Arg(1, &options)
+		s.updateLobby(c, lobbyID, func(l *Lobby) {
+			for k, v := range options {
+				if k == "map" {
+					l.MapTitle, _ = v.(string)
+				} else {
+					l.Options[k] = v
+				}
+			}
+		})
+	case "set_custom_team":
+		var lobbyID string
+		var team int
+		e.Arg(0, &lobbyID)
+		e.Arg(1, &team)
+		userID := c.UserID()
+		s.updateLobby(c, lobbyID, func(l *Lobby) {
+			l.Teams[userID] = team
+		})
+	case "set_custom_host":
+		var lobbyID string
+		var index int
+		e.Arg(0, &lobbyID)
+		e.Arg(1, &index)
+		s.updateLobby(c, lobbyID, func(l *Lobby) {
+			if index > 0 && index < len(l.UserIDs) {
+				host := l.UserIDs[index]
+				copy(l.UserIDs[1:index+1], l.UserIDs[:index])
+				l.UserIDs[0] = host
+			}
+		})
+	case "join_1v1", "play":
+		var userID string
+		e.Arg(0, &userID)
+		c.setUserID(userID)
+		s.joinQueue(e.Name, userID)
+	case "join_team":
+		var teamID, userID string
+		e.Arg(0, &teamID)
+		e.Arg(1, &userID)
+		c.setUserID(userID)
+		s.joinQueue(e.Name+":"+teamID, userID)
+	case "cancel":
+		for _, lobbyID := range s.leaveLobbies(c.UserID()) {
+			s.sendQueueUpdate(lobbyID)
+		}
+		s.leaveQueues(c.UserID())
+	}
+}
+
+// Queued returns the user IDs waiting in a matchmaking queue.
+// Queues are named after the event used to join them: "join_1v1", "play" or "join_team:<teamID>".
+func (s *Server) Queued(queue string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queues[queue]...)
+}
+
+// Adds the user to a matchmaking queue and tells everyone in it how many players are waiting
+func (s *Server) joinQueue(queue, userID string) {
+	s.mu.Lock()
+	s.queues[queue] = append(s.queues[queue], userID)
+	queued := append([]string(nil), s.queues[queue]...)
+	s.mu.Unlock()
+
+	for _, c := range s.Conns() {
+		for _, id := range queued {
+			if c.UserID() == id {
+				c.Emit("queue_update", map[string]interface{}{
+					"numPlayers": len(queued),
+					"numForce":   0,
+					"isForcing":  false,
+				})
+			}
+		}
+	}
+}
+
+// Removes the user from every matchmaking queue
+func (s *Server) leaveQueues(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, queued := range s.queues {
+		for i, id := range queued {
+			if id == userID {
+				s.queues[name] = append(queued[:i], queued[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Applies a change to a lobby and sends the updated lobby to everyone in it.
+// Changes from users who are not in the lobby are ignored.
+func (s *Server) updateLobby(c *Conn, lobbyID string, change func(l *Lobby)) {
+	s.mu.Lock()
+	l, ok := s.lobbies[lobbyID]
+	member := false
+	if ok {
+		for _, id := range l.UserIDs {
+			member = member || id == c.UserID()
+		}
+	}
+	if member {
+		change(l)
+	}
+	s.mu.Unlock()
+
+	if member {
+		s.sendQueueUpdate(lobbyID)
+	}
+}
+
+func (s *Server) joinLobby(lobbyID, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.lobbies[lobbyID]
+	if !ok {
+		l = newLobby(lobbyID)
+		s.lobbies[lobbyID] = l
+	}
+	for _, id := range l.UserIDs {
+		if id == userID {
+			return
+		}
+	}
+	l.UserIDs = append(l.UserIDs, userID)
+}
+
+// Removes the user from every lobby and returns the IDs of the lobbies they left
+func (s *Server) leaveLobbies(userID string) (left []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.lobbies {
+		for i, id := range l.UserIDs {
+			if id == userID {
+				l.UserIDs = append(l.UserIDs[:i], l.UserIDs[i+1:]...)
+				delete(l.Forcing, userID)
+				delete(l.Teams, userID)
+				left = append(left, l.ID)
+				break
+			}
+		}
+	}
+	return
+}
+
+// Sends a queue_update describing the lobby to every connection in it
+func (s *Server) sendQueueUpdate(lobbyID string) {
+	l := s.Lobby(lobbyID)
+	if l == nil {
+		return
+	}
+	usernames := make([]string, len(l.UserIDs))
+	indices := make([]int, len(l.UserIDs))
+	teams := make([]int, len(l.UserIDs))
+	numForce := 0
+	for i, id := range l.UserIDs {
+		usernames[i] = s.Username(id)
+		indices[i] = i
+		teams[i] = i + 1
+		if team, ok := l.Teams[id]; ok {
+			teams[i] = team
+		}
+		if l.Forcing[id] {
+			numForce++
+		}
+	}
+
+	for _, c := range s.Conns() {
+		for i, id := range l.UserIDs {
+			if c.UserID() != id {
+				continue
+			}
+			c.Emit("queue_update", map[string]interface{}{
+				"mapTitle":      l.MapTitle,
+				"options":       l.Options,
+				"lobbyIndex":    i,
+				"isForcing":     l.Forcing[id],
+				"numForce":      numForce,
+				"playerIndices": indices,
+				"usernames":     usernames,
+				"teams":         teams,
+			})
+		}
+	}
+}
+
+// Conn is a single client connection to the fake server
+type Conn struct {
+	s   *Server
+	ws  *websocket.Conn
+	sid string
+
+	mu     sync.Mutex
+	userID string
+	closed bool
+	// Last map and cities sent to this connection, used to compute diffs
+	mapRaw    []int
+	citiesRaw []int
+}
+
+// SID returns the session ID of the connection
+func (c *Conn) SID() string {
+	return c.sid
+}
+
+// UserID returns the user ID the client last joined a lobby with
+func (c *Conn) UserID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.userID
+}
+
+func (c *Conn) setUserID(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.userID = userID
+}
+
+// Emit sends an event to the client
+func (c *Conn) Emit(event string, args ...interface{}) error {
+	p, err := protocol.NewEvent(event, args...)
+	if err != nil {
+		return err
+	}
+	return c.write(protocol.EncodeMessage(p))
+}
+
+// Ack replies to an event the client sent with an acknowledgement ID
+func (c *Conn) Ack(ackID int, args ...interface{}) error {
+	if ackID < 0 {
+		return nil
+	}
+	p, err := protocol.NewAck(ackID, args...)
+	if err != nil {
+		return err
+	}
+	return c.write(protocol.EncodeMessage(p))
+}
+
+// Close closes the connection
+func (c *Conn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.ws.Close()
+	}
+}
+
+// Writes an encoded packet to the connection
+func (c *Conn) write(packet []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errors.New("Error: Connection closed")
+	}
+	return c.ws.WriteMessage(websocket.TextMessage, packet)
+}
@@ -0,0 +1,127 @@
+// Package fakeserver implements an in-process stand-in for the Generals.io socket.io server.
+//
+// Game adds scripting of game_start, game_update and game_over events.
+package fakeserver
+
+// GameStart describes a game started by the fake server
+type GameStart struct {
+	PlayerIndex int      `json:"playerIndex"`
+	ReplayID    string   `json:"replay_id"`
+	ChatRoom    string   `json:"chat_room"`
+	Usernames   []string `json:"usernames"`
+	Teams       []int    `json:"teams,omitempty"`
+}
+
+// Score is the score of a single player in a game update
+type Score struct {
+	Armies int  `json:"total"`
+	Tiles  int  `json:"tiles"`
+	Index  int  `json:"i"`
+	Dead   bool `json:"dead"`
+}
+
+// Update is the full state of a game at a given turn. The server diffs it against the last
+// update sent to each connection, the same way Generals.io does.
+type Update struct {
+	Turn        int
+	AttackIndex int
+	Width       int
+	Height      int
+	// Army count of every cell, in row-major order
+	Armies []int
+	// Terrain (owner or tile code) of every cell, in row-major order
+	Terrain []int
+	// Indices of the visible cities
+	Cities []int
+	// Index of each player's general, or -1 if unknown
+	Generals []int
+	Scores   []Score
+}
+
+// StartGame sends pre_game_start and game_start to every connection
+func (s *Server) StartGame(start GameStart) {
+	for _, c := range s.Conns() {
+		c.mu.Lock()
+		c.mapRaw = nil
+		c.citiesRaw = nil
+		c.mu.Unlock()
+		c.Emit("pre_game_start")
+		c.Emit("game_start", start)
+	}
+}
+
+// SendUpdate sends a game_update to every connection
+func (s *Server) SendUpdate(update Update) {
+	for _, c := range s.Conns() {
+		c.SendUpdate(update)
+	}
+}
+
+// EndGame sends game_won or game_lost followed by game_over to every connection
+func (s *Server) EndGame(won bool) {
+	for _, c := range s.Conns() {
+		if won {
+			c.Emit("game_won")
+		} else {
+			c.Emit("game_lost")
+		}
+		c.Emit("game_over")
+	}
+}
+
+// SendUpdate sends a game_update to the client, diffed against the last update it received
+func (c *Conn) SendUpdate(update Update) error {
+	mapRaw := append([]int{update.Width, update.Height}, update.Armies...)
+	mapRaw = append(mapRaw, update.Terrain...)
+	cities := append([]int{}, update.Cities...)
+
+	c.mu.Lock()
+	mapDiff := diff(c.mapRaw, mapRaw)
+	citiesDiff := diff(c.citiesRaw, cities)
+	c.mapRaw = mapRaw
+	c.citiesRaw = cities
+	c.mu.Unlock()
+
+	generals := update.Generals
+	if generals == nil {
+		generals = []int{}
+	}
+	scores := update.Scores
+	if scores == nil {
+		scores = []Score{}
+	}
+	return c.Emit("game_update", map[string]interface{}{
+		"turn":        update.Turn,
+		"attackIndex": update.AttackIndex,
+		"map_diff":    mapDiff,
+		"cities_diff": citiesDiff,
+		"generals":    generals,
+		"scores":      scores,
+	})
+}
+
+// Computes a Generals.io patch turning old into cur.
+// The patch alternates between a count of values to keep from old, and a count of new values
+// followed by the values themselves.
+func diff(old, cur []int) []int {
+	patch := []int{}
+	i := 0
+	for i < len(cur) {
+		start := i
+		for i < len(cur) && i < len(old) && old[i] == cur[i] {
+			i++
+		}
+		patch = append(patch, i-start)
+		if i >= len(cur) {
+			break
+		}
+
+		start = i
+		for i < len(cur) && (i >= len(old) || old[i] != cur[i]) {
+			i++
+		}
+		patch = append(patch, i-start)
+		patch = append(patch, cur[start:i]...)
+	}
+	return patch
+}
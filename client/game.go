@@ -3,7 +3,10 @@
 // Game adds types and interfaces for the Client to interact with a user provide Game module.
 package client
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+)
 
 // BaseGame is a base type used by the client to store the gamestate of a game on Generals.io
 // Specific bot/game implmentations should extend this type
@@ -22,3 +25,41 @@ type IGame interface {
 
 	NextAttackIndex() int
 }
+
+// WaitForGameStart blocks until a game starts, the client is closed or the context is done.
+// It returns immediately if we are already playing a game. Errors of the custom game or queue we
+// are waiting in fail the wait.
+func (c *Client) WaitForGameStart(ctx context.Context) error {
+	w := c.expect("game_start")
+	if c.Lobby() != nil {
+		w.failOn(ErrCustomGame, ErrBanned)
+	} else {
+		w.failOn(ErrQueue, ErrBanned)
+	}
+	if c.State() == StateInGame {
+		w.cancel()
+		return nil
+	}
+	_, err := w.wait(ctx)
+	return err
+}
+
+// WaitForGameEnd blocks until the current game ends, the client is closed or the context is done.
+// It returns true if we won the game.
+func (c *Client) WaitForGameEnd(ctx context.Context) (bool, error) {
+	evt, err := c.expect("game_won", "game_lost", "game_over").failOn(ErrBanned).wait(ctx)
+	if err != nil {
+		return false, err
+	}
+	return evt.Name == "game_won", nil
+}
+
+// Resyncer is implemented by games which can discard their map state after the client reconnected
+type Resyncer interface {
+	Resync()
+}
+
+// ChatReceiver is implemented by games which handle the chat messages sent during the game
+type ChatReceiver interface {
+	ChatMessage(raw json.RawMessage)
+}
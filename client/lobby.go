@@ -4,16 +4,24 @@
 package client
 
 import (
-	"errors"
-	"log"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
 )
 
 // Lobby is a type representing a game lobby on Generals.io
+//
+// It is updated from queue_update events on the goroutine running Client.Run, and is safe to read
+// from any goroutine through its accessors.
 type Lobby struct {
 	// Client used to interact with this lobby (might remove this?)
 	c *Client
 	// ID of the custom lobby
 	ID string
+
+	// Guards the fields below
+	mu sync.RWMutex
 	// Custom Map title if lobby is using one
 	mapTitle string
 	// True if we are voting to force a start
@@ -28,6 +36,31 @@ type Lobby struct {
 	usernames []string
 	// Team ID of all players (in index order)
 	teams []int
+	// Custom game options of the lobby
+	options GameOptions
+}
+
+// LobbyPlayer is a player waiting in a Lobby
+type LobbyPlayer struct {
+	// Index of the player in the lobby
+	Index    int
+	Username string
+	// Team the player is on
+	Team int
+}
+
+// GameOptions are the custom game options of a Lobby.
+//
+// Sizes and densities are relative values between 0 and 1, as shown by the sliders on Generals.io
+type GameOptions struct {
+	GameSpeed       float64 `json:"game_speed"`
+	Width           float64 `json:"width"`
+	Height          float64 `json:"height"`
+	CityDensity     float64 `json:"city_density"`
+	MountainDensity float64 `json:"mountain_density"`
+	SwampDensity    float64 `json:"swamp_density"`
+	// IDs of the enabled game modifiers
+	Modifiers []int `json:"modifiers"`
 }
 
 // NewLobby create a new Lobby instance with the given ID
@@ -39,18 +72,22 @@ func NewLobby(ID string) *Lobby {
 
 // QueueUpdate JSON Datastructure returned by server for most state changes in a Lobby
 type QueueUpdate struct {
-	MapTitle      string   `json:"mapTitle"`
-	LobbyIndex    int      `json:"lobbyIndex"`
-	IsForcing     bool     `json:"isForcing"`
-	NumForce      int      `json:"numForce"`
-	PlayerIndices []int    `json:"playerIndices"`
-	Usernames     []string `json:"usernames"`
-	Teams         []int    `json:"teams"`
-	// Options TODO: Implement tracking options
+	MapTitle      string      `json:"mapTitle"`
+	LobbyIndex    int         `json:"lobbyIndex"`
+	IsForcing     bool        `json:"isForcing"`
+	NumForce      int         `json:"numForce"`
+	PlayerIndices []int       `json:"playerIndices"`
+	Usernames     []string    `json:"usernames"`
+	Teams         []int       `json:"teams"`
+	Options       GameOptions `json:"options"`
 }
 
 // Update updates Lobby instance with a information from server
 func (l *Lobby) Update(update QueueUpdate) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.options = update.Options
 	l.lobbyIndex = update.LobbyIndex
 	l.mapTitle = update.MapTitle
 	l.isForcing = update.IsForcing
@@ -60,33 +97,175 @@ func (l *Lobby) Update(update QueueUpdate) {
 	l.teams = update.Teams
 }
 
-// JoinCustomGame joins a custom game with the specified ID
-func (c *Client) JoinCustomGame(ID string) {
-	log.Printf("Joined custom game at http://bot.generals.io/games/%v", ID)
-	c.sendMessage(msg, "join_private", ID, c.user.userID)
-	c.lobby = NewLobby(ID)
-	// g := &Game{c: c, ID: ID}
-	// g.registerEvents()
-	// return g
+// MapTitle returns the title of the custom map the lobby is using, if any
+func (l *Lobby) MapTitle() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.mapTitle
+}
+
+// IsForcing returns true if we are voting to force a start
+func (l *Lobby) IsForcing() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.isForcing
+}
+
+// NumForce returns the number of players voting to force a start
+func (l *Lobby) NumForce() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.numForce
+}
+
+// LobbyIndex returns our index in the lobby
+func (l *Lobby) LobbyIndex() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lobbyIndex
+}
+
+// NumPlayers returns the number of players in the lobby
+func (l *Lobby) NumPlayers() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.usernames)
+}
+
+// Players returns the players in the lobby, in index order
+func (l *Lobby) Players() []LobbyPlayer {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	players := make([]LobbyPlayer, len(l.usernames))
+	for i, username := range l.usernames {
+		players[i] = LobbyPlayer{Index: i, Username: username}
+		if i < len(l.playerIndices) {
+			players[i].Index = l.playerIndices[i]
+		}
+		if i < len(l.teams) {
+			players[i].Team = l.teams[i]
+		}
+	}
+	return players
+}
+
+// Teams returns the players in the lobby grouped by team
+func (l *Lobby) Teams() map[int][]LobbyPlayer {
+	teams := make(map[int][]LobbyPlayer)
+	for _, p := range l.Players() {
+		teams[p.Team] = append(teams[p.Team], p)
+	}
+	return teams
 }
 
-// SetForceStart changes our force start status in the current Lobby
+// Options returns the custom game options of the lobby
+func (l *Lobby) Options() GameOptions {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	opts := l.options
+	opts.Modifiers = append([]int(nil), l.options.Modifiers...)
+	return opts
+}
+
+// Lobby returns the custom Lobby we are in, or nil if we are not in one
+func (c *Client) Lobby() *Lobby {
+	c.lobbyMu.Lock()
+	defer c.lobbyMu.Unlock()
+	return c.lobby
+}
+
+// Sets the custom Lobby we are in
+func (c *Client) setLobby(l *Lobby) {
+	c.lobbyMu.Lock()
+	defer c.lobbyMu.Unlock()
+	c.lobby = l
+}
+
+// Applies a queue_update to the current Lobby and notifies OnLobbyUpdate
+func (c *Client) handleLobbyUpdate(raw json.RawMessage) {
+	l := c.Lobby()
+	if l == nil {
+		return
+	}
+
+	update := QueueUpdate{}
+	decode := []interface{}{nil, &update}
+	if err := json.Unmarshal(raw, &decode); err != nil {
+		return
+	}
+	l.Update(update)
+
+	if c.OnLobbyUpdate != nil {
+		c.OnLobbyUpdate(l)
+	}
+}
+
+// WaitForPlayers blocks until at least n players are in the current Lobby, the client is closed or
+// the context is done
+func (c *Client) WaitForPlayers(ctx context.Context, n int) error {
+	for {
+		w := c.expect("queue_update").failOn(ErrCustomGame, ErrBanned)
+		l := c.Lobby()
+		if l == nil {
+			w.cancel()
+			return ErrNotInLobby
+		}
+		if l.NumPlayers() >= n {
+			w.cancel()
+			return nil
+		}
+		if _, err := w.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// JoinCustomGame joins a custom game with the specified ID.
+// It blocks until the server confirms we are in the lobby, or the context is done.
+func (c *Client) JoinCustomGame(ctx context.Context, ID string) error {
+	w := c.expect("queue_update", "game_start").failOn(ErrCustomGame, ErrBanned, ErrInvalidUserID)
+	c.queue.mu.Lock()
+	c.queue.queue = nil
+	c.queue.mu.Unlock()
+	// Set the lobby first, so the server's first update is applied to it
+	c.setLobby(NewLobby(ID))
+	c.sendEvent("join_private", ID, c.user.userID)
+
+	if _, err := w.wait(ctx); err != nil {
+		return fmt.Errorf("Error: Could not join custom game %v: %w", ID, err)
+	}
+	c.log.Info("Joined custom game", "lobby", ID, "user", c.user.username, "url", "http://bot.generals.io/games/"+ID)
+	c.state.transitionFrom(StateInLobby, StateConnected, StateRegistered)
+	return nil
+}
+
+// SetForceStart changes our force start status in the current Lobby or matchmaking queue
 func (c *Client) SetForceStart(force bool) error {
-	if c.lobby == nil {
-		return errors.New("Error: Can't force start a game when not in a Lobby. Try joining a game first")
+	if q := c.Queue(); q != nil {
+		if q.Kind == Queue1v1 {
+			return ErrForceStart1v1
+		}
+		c.sendEvent("set_force_start", q.TeamID, force)
+		return nil
+	}
+	l := c.Lobby()
+	if l == nil {
+		return ErrNotInLobby
 	}
 
-	c.sendMessage(msg, "set_force_start", c.lobby.ID, force)
+	c.sendEvent("set_force_start", l.ID, force)
 	return nil
 }
 
 // LeaveLobby leaves the current Lobby
 func (c *Client) LeaveLobby() error {
-	if c.lobby == nil {
-		return errors.New("Error: Can't leave a Lobby when not in one. Try joining a game first")
+	if c.Lobby() == nil {
+		return ErrNotInLobby
 	}
 
-	c.sendMessage(msg, "cancel")
-	c.lobby = nil
+	c.sendEvent("cancel")
+	c.setLobby(nil)
+	c.state.transitionFrom(StateRegistered, StateInLobby)
 	return nil
 }
@@ -0,0 +1,43 @@
+package client_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/brisberg/generals-io-bot/client"
+	"github.com/brisberg/generals-io-bot/client/fakeserver"
+)
+
+func TestJoinCustomGameAppliesFirstUpdate(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	s.SetUsername("user1", "[Bot]one")
+	var mu sync.Mutex
+	updated := []string{}
+	c, _ := runReconnecting(t, s, 0, func(c *client.Client) {
+		c.OnLobbyUpdate = func(l *client.Lobby) {
+			mu.Lock()
+			defer mu.Unlock()
+			updated = append(updated, l.ID)
+		}
+	})
+	if err := c.RegisterBot(ctxWithTimeout(t), "user1", "[Bot]one"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The update answering the join belongs to the lobby being joined, never the previous one
+	for _, id := range []string{"lobby1", "lobby2", "lobby3"} {
+		if err := c.JoinCustomGame(ctxWithTimeout(t), id); err != nil {
+			t.Fatalf("JoinCustomGame(%v): %v", id, err)
+		}
+		if l := c.Lobby(); l == nil || l.ID != id || l.NumPlayers() != 1 {
+			t.Errorf("Lobby() after joining %v = %+v, want the server's update applied", id, l)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"lobby1", "lobby2", "lobby3"}; !reflect.DeepEqual(updated, want) {
+		t.Errorf("OnLobbyUpdate called for %v, want %v", updated, want)
+	}
+}
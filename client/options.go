@@ -0,0 +1,129 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Options adds configuration of the server endpoint and the WebSocket dialer.
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/logger"
+	"github.com/gorilla/websocket"
+)
+
+// Options configures how the client dials the server
+type Options struct {
+	// Full WebSocket URL of the socket.io endpoint, including the query string.
+	// Defaults to the US server. Use ServerURL to build the URL of another Generals.io server.
+	URL string
+
+	// TLS configuration used for wss:// endpoints. Nil uses the default configuration
+	TLSConfig *tls.Config
+
+	// Extra HTTP headers sent with the WebSocket handshake (Origin, Cookie, User-Agent, ...)
+	Header http.Header
+
+	// Proxy returns the proxy to use for a request. Nil connects directly.
+	// Use http.ProxyFromEnvironment to respect the HTTP_PROXY environment variables.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// Timeout for the WebSocket handshake. 0 means no timeout
+	HandshakeTimeout time.Duration
+
+	// Negotiate per message compression with the server
+	EnableCompression bool
+
+	// Engine.IO protocol version to speak. Defaults to EIO3. The EIO query parameter of the URL is
+	// set to match
+	Protocol ProtocolVersion
+
+	// Priorities, rate limits and drop policies of outbound messages. Nil uses DefaultOutboxPolicy
+	Outbox *OutboxPolicy
+
+	// Records the traffic with the server to a capture file. Nil records nothing
+	Recorder *Recorder
+
+	// Logger for the client. Nil uses the default logger of the logger package
+	Logger logger.Logger
+
+	// Logger for every frame sent or received, at Debug level. Nil uses Logger. Use logger.Sample
+	// or logger.Nop to thin out or silence the frame logs
+	FrameLogger logger.Logger
+}
+
+// ServerURL returns the WebSocket URL of a Generals.io server
+//
+// Server param should be one of "" = US, "es" = Europe, "bot" = Bot (SF) server
+func ServerURL(server string) string {
+	return fmt.Sprintf(serverPtn, server)
+}
+
+// Returns the URL to dial, falling back to the US server
+func (o *Options) url() string {
+	raw := o.URL
+	if raw == "" {
+		raw = ServerURL("")
+	}
+	if o.Protocol == 0 {
+		return raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		// Let the dialer report the malformed URL
+		return raw
+	}
+	q := u.Query()
+	q.Set("EIO", strconv.Itoa(int(o.Protocol)))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Returns the protocol version to speak, defaulting to EIO3
+func (o *Options) protocol() ProtocolVersion {
+	if o.Protocol == 0 {
+		return EIO3
+	}
+	return o.Protocol
+}
+
+// Returns the transport for the protocol version. dial validates the version before it is used
+func (o *Options) transport() transport {
+	t, _ := newTransport(o.protocol())
+	return t
+}
+
+// Returns the logger of the client
+func (o *Options) logger() logger.Logger {
+	return logger.Or(o.Logger)
+}
+
+// Returns the logger for frames
+func (o *Options) frameLogger() logger.Logger {
+	if o.FrameLogger != nil {
+		return o.FrameLogger
+	}
+	return o.logger()
+}
+
+// Returns the policy of the outbox
+func (o *Options) outboxPolicy() OutboxPolicy {
+	if o.Outbox == nil {
+		return DefaultOutboxPolicy
+	}
+	return *o.Outbox
+}
+
+// Builds a WebSocket dialer from the options
+func (o *Options) dialer() *websocket.Dialer {
+	return &websocket.Dialer{
+		Proxy:             o.Proxy,
+		TLSClientConfig:   o.TLSConfig,
+		HandshakeTimeout:  o.HandshakeTimeout,
+		EnableCompression: o.EnableCompression,
+	}
+}
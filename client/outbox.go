@@ -0,0 +1,307 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Outbox adds the prioritised and rate limited queue of outbound messages.
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Priority is the class of an outbound message. Classes with a lower value are always sent first
+type Priority int
+
+const (
+	// PriorityMove is used for attacks and other move orders
+	PriorityMove Priority = iota
+	// PriorityPing is used for Engine.IO heartbeats
+	PriorityPing
+	// PriorityLobby is used for registration, queue and lobby requests
+	PriorityLobby
+	// PriorityChat is used for chat messages
+	PriorityChat
+
+	numPriorities
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityMove:
+		return "Move"
+	case PriorityPing:
+		return "Ping"
+	case PriorityLobby:
+		return "Lobby"
+	case PriorityChat:
+		return "Chat"
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// DropPolicy decides which message is dropped when a class of the outbox is full
+type DropPolicy int
+
+const (
+	// DropOldest drops the oldest queued message to make room for the new one
+	DropOldest DropPolicy = iota
+	// DropNewest drops the new message
+	DropNewest
+)
+
+// ClassPolicy configures the queue of one priority class
+type ClassPolicy struct {
+	// Number of messages which may be sent back to back. Defaults to 1 if Interval is set
+	Burst int
+	// Time to earn back one message of the burst. 0 means the class is not rate limited
+	Interval time.Duration
+	// Maximum number of queued messages. 0 means the queue is unbounded
+	MaxDepth int
+	// Message dropped once MaxDepth is reached
+	Drop DropPolicy
+	// Replace a queued request with a newer request of the same kind instead of queuing both.
+	// Only requests where the latest one wins are coalesced (force start, team and host changes)
+	Coalesce bool
+}
+
+// OutboxPolicy configures each priority class of the outbox
+type OutboxPolicy struct {
+	Moves ClassPolicy
+	Pings ClassPolicy
+	Lobby ClassPolicy
+	Chat  ClassPolicy
+}
+
+// DefaultOutboxPolicy never holds back moves or heartbeats, and keeps lobby requests and chat well
+// under the rates the server tolerates
+var DefaultOutboxPolicy = OutboxPolicy{
+	Lobby: ClassPolicy{
+		Burst:    5,
+		Interval: 200 * time.Millisecond,
+		MaxDepth: 64,
+		Drop:     DropOldest,
+		Coalesce: true,
+	},
+	Chat: ClassPolicy{
+		Burst:    3,
+		Interval: time.Second,
+		MaxDepth: 16,
+		Drop:     DropNewest,
+	},
+}
+
+// Returns the policy of a priority class
+func (p OutboxPolicy) class(priority Priority) ClassPolicy {
+	switch priority {
+	case PriorityMove:
+		return p.Moves
+	case PriorityPing:
+		return p.Pings
+	case PriorityLobby:
+		return p.Lobby
+	}
+	return p.Chat
+}
+
+// OutboxStats are the metrics of one priority class of the outbox
+type OutboxStats struct {
+	// Number of messages waiting to be sent
+	Depth int
+	// Highest number of messages which waited at once
+	PeakDepth int
+	// Number of messages written to the connection
+	Sent int
+	// Number of messages dropped because the queue was full
+	Dropped int
+	// Number of messages replaced by a newer message of the same kind
+	Coalesced int
+}
+
+// A message waiting in the outbox
+type outboundMessage struct {
+	data []byte
+	// Kind of request, used for coalescing. Empty if the message is never coalesced
+	key string
+	// Called if the message is dropped from a full queue. Nil if nobody needs to know
+	dropped func()
+}
+
+// Queue and token bucket of one priority class
+type outboxClass struct {
+	policy     ClassPolicy
+	queue      []outboundMessage
+	tokens     int
+	lastRefill time.Time
+	stats      OutboxStats
+}
+
+// outbox schedules outbound messages by priority class, holding back classes over their rate limit
+type outbox struct {
+	mu      sync.Mutex
+	classes [numPriorities]*outboxClass
+	// Wakes the writer when a message is queued
+	notify chan struct{}
+}
+
+func newOutbox(policy OutboxPolicy) *outbox {
+	o := &outbox{notify: make(chan struct{}, 1)}
+	now := time.Now()
+	for p := range o.classes {
+		class := policy.class(Priority(p))
+		if class.Interval > 0 && class.Burst < 1 {
+			class.Burst = 1
+		}
+		o.classes[p] = &outboxClass{policy: class, tokens: class.Burst, lastRefill: now}
+	}
+	return o
+}
+
+// Queues a message. It never blocks: a full class drops a message according to its DropPolicy,
+// and calls the dropped callback of that message, if it has one
+func (o *outbox) push(priority Priority, key string, data []byte, dropped func()) {
+	o.mu.Lock()
+	class := o.classes[priority]
+	msg := outboundMessage{data: data, key: key, dropped: dropped}
+
+	if class.policy.Coalesce && key != "" {
+		for i := range class.queue {
+			if class.queue[i].key == key {
+				class.queue[i] = msg
+				class.stats.Coalesced++
+				o.mu.Unlock()
+				return
+			}
+		}
+	}
+	var lost outboundMessage
+	if class.policy.MaxDepth > 0 && len(class.queue) >= class.policy.MaxDepth {
+		class.stats.Dropped++
+		if class.policy.Drop == DropNewest {
+			o.mu.Unlock()
+			if dropped != nil {
+				dropped()
+			}
+			return
+		}
+		lost = class.queue[0]
+		class.queue = class.queue[1:]
+	}
+	class.queue = append(class.queue, msg)
+	if len(class.queue) > class.stats.PeakDepth {
+		class.stats.PeakDepth = len(class.queue)
+	}
+	o.mu.Unlock()
+
+	if lost.dropped != nil {
+		lost.dropped()
+	}
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Blocks until a message may be sent and returns it. Returns false once done is closed
+func (o *outbox) next(done <-chan bool) ([]byte, bool) {
+	for {
+		o.mu.Lock()
+		now := time.Now()
+		var wait time.Duration
+		for _, class := range o.classes {
+			if len(class.queue) == 0 {
+				continue
+			}
+			class.refill(now)
+			if class.policy.Interval == 0 || class.tokens > 0 {
+				msg := class.queue[0]
+				class.queue = class.queue[1:]
+				if class.policy.Interval > 0 {
+					class.tokens--
+				}
+				class.stats.Sent++
+				o.mu.Unlock()
+				return msg.data, true
+			}
+			if d := class.lastRefill.Add(class.policy.Interval).Sub(now); wait == 0 || d < wait {
+				wait = d
+			}
+		}
+		o.mu.Unlock()
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+		select {
+		case <-o.notify:
+		case <-expired:
+		case <-done:
+			return nil, false
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// Earns back the messages of the burst for the time elapsed since the last refill
+func (c *outboxClass) refill(now time.Time) {
+	if c.policy.Interval == 0 {
+		return
+	}
+	if c.tokens >= c.policy.Burst {
+		c.lastRefill = now
+		return
+	}
+	earned := int(now.Sub(c.lastRefill) / c.policy.Interval)
+	if earned > 0 {
+		c.tokens += earned
+		c.lastRefill = c.lastRefill.Add(time.Duration(earned) * c.policy.Interval)
+		if c.tokens >= c.policy.Burst {
+			c.tokens = c.policy.Burst
+			c.lastRefill = now
+		}
+	}
+}
+
+// Returns the metrics of every priority class
+func (o *outbox) stats() map[Priority]OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := make(map[Priority]OutboxStats, len(o.classes))
+	for p, class := range o.classes {
+		s := class.stats
+		s.Depth = len(class.queue)
+		stats[Priority(p)] = s
+	}
+	return stats
+}
+
+// OutboxStats returns the queue depth and counters of each priority class of the outbound queue
+func (c *Client) OutboxStats() map[Priority]OutboxStats {
+	return c.outbox.stats()
+}
+
+// Returns the priority class of an event
+func eventPriority(event string) Priority {
+	switch event {
+	case "attack", "clear_moves", "undo_move":
+		return PriorityMove
+	case "chat_message":
+		return PriorityChat
+	}
+	return PriorityLobby
+}
+
+// Returns the key under which queued requests of an event are coalesced, or "" if every request
+// must be sent
+func coalesceKey(event string) string {
+	switch event {
+	case "set_force_start", "set_custom_team", "set_custom_host":
+		return event
+	}
+	return ""
+}
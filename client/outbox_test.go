@@ -0,0 +1,181 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+// Returns the next message of the outbox, failing the test if none is ready within wait
+func nextWithin(t *testing.T, o *outbox, wait time.Duration) string {
+	t.Helper()
+	done := make(chan bool)
+	timer := time.AfterFunc(wait, func() { close(done) })
+	defer timer.Stop()
+	data, ok := o.next(done)
+	if !ok {
+		t.Fatalf("no message ready within %v", wait)
+	}
+	return string(data)
+}
+
+// Fails the test if a message is ready within wait
+func expectEmpty(t *testing.T, o *outbox, wait time.Duration) {
+	t.Helper()
+	done := make(chan bool)
+	timer := time.AfterFunc(wait, func() { close(done) })
+	defer timer.Stop()
+	if data, ok := o.next(done); ok {
+		t.Fatalf("got %q, want no message within %v", data, wait)
+	}
+}
+
+func TestOutboxPriorityOrder(t *testing.T) {
+	o := newOutbox(OutboxPolicy{})
+	o.push(PriorityChat, "", []byte("chat"), nil)
+	o.push(PriorityLobby, "", []byte("lobby"), nil)
+	o.push(PriorityPing, "", []byte("ping"), nil)
+	o.push(PriorityMove, "", []byte("move 1"), nil)
+	o.push(PriorityMove, "", []byte("move 2"), nil)
+
+	for _, want := range []string{"move 1", "move 2", "ping", "lobby", "chat"} {
+		if got := nextWithin(t, o, time.Second); got != want {
+			t.Errorf("next() = %q, want %q", got, want)
+		}
+	}
+	expectEmpty(t, o, 20*time.Millisecond)
+}
+
+func TestOutboxRateLimit(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	o := newOutbox(OutboxPolicy{Lobby: ClassPolicy{Burst: 2, Interval: interval}})
+	start := time.Now()
+	for _, m := range []string{"a", "b", "c", "d"} {
+		o.push(PriorityLobby, "", []byte(m), nil)
+	}
+
+	// The burst goes out at once, then one message per interval
+	for i, want := range []string{"a", "b", "c", "d"} {
+		if got := nextWithin(t, o, time.Second); got != want {
+			t.Errorf("next() = %q, want %q", got, want)
+		}
+		elapsed := time.Since(start)
+		earliest := time.Duration(0)
+		if i >= 2 {
+			earliest = time.Duration(i-1) * interval
+		}
+		if elapsed < earliest-5*time.Millisecond || elapsed > earliest+40*time.Millisecond {
+			t.Errorf("message %q sent after %v, want about %v", want, elapsed, earliest)
+		}
+	}
+}
+
+func TestOutboxRefillIsCappedAtBurst(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	o := newOutbox(OutboxPolicy{Lobby: ClassPolicy{Burst: 2, Interval: interval}})
+	o.push(PriorityLobby, "", []byte("a"), nil)
+	nextWithin(t, o, time.Second)
+
+	// Idle long enough to earn many messages, only the burst is available
+	time.Sleep(10 * interval)
+	for _, m := range []string{"b", "c", "d"} {
+		o.push(PriorityLobby, "", []byte(m), nil)
+	}
+	nextWithin(t, o, 5*time.Millisecond)
+	nextWithin(t, o, 5*time.Millisecond)
+	expectEmpty(t, o, interval/2)
+	if got := nextWithin(t, o, time.Second); got != "d" {
+		t.Errorf("next() = %q, want d", got)
+	}
+}
+
+func TestOutboxRateLimitDoesNotHoldBackOtherClasses(t *testing.T) {
+	o := newOutbox(OutboxPolicy{Chat: ClassPolicy{Burst: 1, Interval: time.Hour}})
+	o.push(PriorityChat, "", []byte("chat 1"), nil)
+	o.push(PriorityChat, "", []byte("chat 2"), nil)
+	nextWithin(t, o, time.Second)
+
+	o.push(PriorityLobby, "", []byte("lobby"), nil)
+	if got := nextWithin(t, o, time.Second); got != "lobby" {
+		t.Errorf("next() = %q, want lobby", got)
+	}
+}
+
+func TestOutboxDropPolicies(t *testing.T) {
+	tests := []struct {
+		drop DropPolicy
+		want []string
+		lost string
+	}{
+		{DropOldest, []string{"b", "c"}, "a"},
+		{DropNewest, []string{"a", "b"}, "c"},
+	}
+	for _, tt := range tests {
+		o := newOutbox(OutboxPolicy{Chat: ClassPolicy{MaxDepth: 2, Drop: tt.drop}})
+		lost := []string{}
+		for _, m := range []string{"a", "b", "c"} {
+			m := m
+			o.push(PriorityChat, "", []byte(m), func() { lost = append(lost, m) })
+		}
+		if len(lost) != 1 || lost[0] != tt.lost {
+			t.Errorf("policy %v dropped %v, want %v", tt.drop, lost, tt.lost)
+		}
+		if s := o.stats()[PriorityChat]; s.Dropped != 1 || s.Depth != 2 || s.PeakDepth != 2 {
+			t.Errorf("policy %v stats = %+v", tt.drop, s)
+		}
+		for _, want := range tt.want {
+			if got := nextWithin(t, o, time.Second); got != want {
+				t.Errorf("policy %v: next() = %q, want %q", tt.drop, got, want)
+			}
+		}
+	}
+}
+
+func TestOutboxCoalesce(t *testing.T) {
+	o := newOutbox(OutboxPolicy{Lobby: ClassPolicy{Coalesce: true}, Chat: ClassPolicy{}})
+	o.push(PriorityLobby, "set_force_start", []byte("force true"), nil)
+	o.push(PriorityLobby, "", []byte("join"), nil)
+	o.push(PriorityLobby, "set_force_start", []byte("force false"), nil)
+	o.push(PriorityLobby, "set_custom_team", []byte("team 2"), nil)
+	// Classes without coalescing queue every message
+	o.push(PriorityChat, "key", []byte("chat 1"), nil)
+	o.push(PriorityChat, "key", []byte("chat 2"), nil)
+
+	// The newer request takes the place of the older one in the queue
+	for _, want := range []string{"force false", "join", "team 2", "chat 1", "chat 2"} {
+		if got := nextWithin(t, o, time.Second); got != want {
+			t.Errorf("next() = %q, want %q", got, want)
+		}
+	}
+	if s := o.stats()[PriorityLobby]; s.Coalesced != 1 || s.Sent != 3 {
+		t.Errorf("lobby stats = %+v, want 1 coalesced and 3 sent", s)
+	}
+	if s := o.stats()[PriorityChat]; s.Coalesced != 0 || s.Sent != 2 {
+		t.Errorf("chat stats = %+v, want 2 sent", s)
+	}
+}
+
+func TestOutboxStats(t *testing.T) {
+	o := newOutbox(OutboxPolicy{})
+	for i := 0; i < 3; i++ {
+		o.push(PriorityMove, "", []byte("move"), nil)
+	}
+	nextWithin(t, o, time.Second)
+
+	stats := o.stats()
+	if len(stats) != int(numPriorities) {
+		t.Errorf("stats() has %v classes, want %v", len(stats), numPriorities)
+	}
+	want := OutboxStats{Depth: 2, PeakDepth: 3, Sent: 1}
+	if s := stats[PriorityMove]; s != want {
+		t.Errorf("move stats = %+v, want %+v", s, want)
+	}
+}
+
+func TestOutboxNextReturnsWhenDone(t *testing.T) {
+	o := newOutbox(OutboxPolicy{})
+	done := make(chan bool)
+	close(done)
+	if _, ok := o.next(done); ok {
+		t.Error("next() returned a message from an empty outbox")
+	}
+}
@@ -0,0 +1,73 @@
+package protocol
+
+import (
+	"encoding/json"
+)
+
+// Reassembler collects the binary attachments which follow a BinaryEvent or BinaryAck packet.
+//
+// Placeholders (`{"_placeholder":true,"num":N}`) in the payload are replaced with the attachments
+// encoded as base64 strings, which encoding/json decodes into []byte fields.
+type Reassembler struct {
+	packet  *SocketPacket
+	buffers [][]byte
+}
+
+// Start begins collecting attachments for a binary packet. Any packet still being collected is discarded
+func (r *Reassembler) Start(p SocketPacket) {
+	r.packet = &p
+	r.buffers = nil
+}
+
+// Pending returns true while attachments are being collected
+func (r *Reassembler) Pending() bool {
+	return r.packet != nil
+}
+
+// Add adds the next attachment. Once all attachments have arrived it returns the packet with its
+// placeholders replaced and true
+func (r *Reassembler) Add(attachment []byte) (SocketPacket, bool, error) {
+	if r.packet == nil {
+		return SocketPacket{}, false, engineError(attachment, ErrUnexpectedType)
+	}
+	r.buffers = append(r.buffers, attachment)
+	if len(r.buffers) < r.packet.Attachments {
+		return SocketPacket{}, false, nil
+	}
+
+	p := *r.packet
+	buffers := r.buffers
+	r.packet = nil
+	r.buffers = nil
+
+	var payload interface{}
+	if err := json.Unmarshal(p.Data, &payload); err != nil {
+		return SocketPacket{}, false, socketError(p.Encode(), ErrInvalidPayload)
+	}
+	data, err := json.Marshal(replacePlaceholders(payload, buffers))
+	if err != nil {
+		return SocketPacket{}, false, socketError(p.Encode(), ErrInvalidPayload)
+	}
+	p.Data = data
+	return p, true, nil
+}
+
+// Walks a decoded JSON value replacing attachment placeholders with their buffers
+func replacePlaceholders(v interface{}, buffers [][]byte) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = replacePlaceholders(v[i], buffers)
+		}
+	case map[string]interface{}:
+		if placeholder, _ := v["_placeholder"].(bool); placeholder {
+			if num, ok := v["num"].(float64); ok && int(num) >= 0 && int(num) < len(buffers) {
+				return buffers[int(num)]
+			}
+		}
+		for k := range v {
+			v[k] = replacePlaceholders(v[k], buffers)
+		}
+	}
+	return v
+}
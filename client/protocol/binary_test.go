@@ -0,0 +1,101 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReassembler(t *testing.T) {
+	p, err := DecodeSocketPacket([]byte(`52-["upload",{"_placeholder":true,"num":1},{"file":{"_placeholder":true,"num":0}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r Reassembler
+	r.Start(p)
+	if !r.Pending() {
+		t.Fatal("Pending() = false after Start")
+	}
+	if _, complete, err := r.Add([]byte("first")); complete || err != nil {
+		t.Fatalf("Add(first) = %v, %v, want incomplete", complete, err)
+	}
+	got, complete, err := r.Add([]byte("second"))
+	if !complete || err != nil {
+		t.Fatalf("Add(second) = %v, %v, want complete", complete, err)
+	}
+	if r.Pending() {
+		t.Error("Pending() = true after the last attachment")
+	}
+
+	args := struct {
+		Name   string
+		Second []byte
+		Nested struct {
+			File []byte `json:"file"`
+		}
+	}{}
+	decode := []interface{}{&args.Name, &args.Second, &args.Nested}
+	if err := json.Unmarshal(got.Data, &decode); err != nil {
+		t.Fatal(err)
+	}
+	if args.Name != "upload" || string(args.Second) != "second" || string(args.Nested.File) != "first" {
+		t.Errorf("reassembled %s, decoded to %+v", got.Data, args)
+	}
+	if got.Type != BinaryEvent || got.Attachments != 2 {
+		t.Errorf("reassembled packet %+v", got)
+	}
+}
+
+func TestReassemblerUnexpectedAttachment(t *testing.T) {
+	var r Reassembler
+	if _, _, err := r.Add([]byte("stray")); !errors.Is(err, ErrUnexpectedType) {
+		t.Errorf("Add without Start = %v, want %v", err, ErrUnexpectedType)
+	}
+}
+
+func TestReassemblerOutOfRangePlaceholder(t *testing.T) {
+	var r Reassembler
+	r.Start(SocketPacket{Type: BinaryAck, HasID: true, ID: 1, Attachments: 1, Data: json.RawMessage(`[{"_placeholder":true,"num":5}]`)})
+	got, complete, err := r.Add([]byte("only"))
+	if !complete || err != nil {
+		t.Fatalf("Add = %v, %v", complete, err)
+	}
+	// Placeholders without a matching attachment are left alone
+	want := []interface{}{map[string]interface{}{"_placeholder": true, "num": float64(5)}}
+	var data []interface{}
+	json.Unmarshal(got.Data, &data)
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("reassembled %s", got.Data)
+	}
+}
+
+func FuzzReassemblerAdd(f *testing.F) {
+	f.Add([]byte(`51-["upload",{"_placeholder":true,"num":0}]`), []byte("attachment"))
+	f.Add([]byte(`62-3[{"_placeholder":true,"num":1},{"_placeholder":true,"num":0}]`), []byte{0, 1, 2})
+	f.Add([]byte(`51-[{"_placeholder":true,"num":-1}]`), []byte{})
+	f.Fuzz(func(t *testing.T, packet, attachment []byte) {
+		p, err := DecodeSocketPacket(packet)
+		if err != nil || (p.Type != BinaryEvent && p.Type != BinaryAck) {
+			return
+		}
+
+		var r Reassembler
+		r.Start(p)
+		// Feed a bounded number of attachments, each a variation of the fuzzed one
+		for i := 0; i < 4 && r.Pending(); i++ {
+			got, complete, err := r.Add(append(attachment, byte(i)))
+			if err != nil {
+				var decodeErr *DecodeError
+				if !errors.As(err, &decodeErr) {
+					t.Fatalf("Add returned %T, want *DecodeError", err)
+				}
+				return
+			}
+			if complete && !json.Valid(got.Data) {
+				t.Fatalf("reassembled invalid JSON %q", got.Data)
+			}
+		}
+	})
+}
@@ -0,0 +1,126 @@
+// Package protocol encodes and decodes the Engine.IO and socket.io packets spoken by Generals.io.
+//
+// Engine.IO packets are the frames sent over the WebSocket. Message packets carry a socket.io packet,
+// which holds events, acknowledgements and namespace connections.
+package protocol
+
+import (
+	"encoding/json"
+)
+
+// EngineType is the type of an Engine.IO packet
+type EngineType byte
+
+const (
+	// Open is sent by the server with the Handshake when the connection opens
+	Open EngineType = iota
+	// Close requests the transport to close
+	Close
+	// Ping is sent by the client (v3) or the server (v4) to check the connection
+	Ping
+	// Pong answers a Ping
+	Pong
+	// Message carries a socket.io packet
+	Message
+	// Upgrade completes a transport upgrade
+	Upgrade
+	// Noop does nothing, used during transport upgrades
+	Noop
+)
+
+func (t EngineType) String() string {
+	names := []string{"open", "close", "ping", "pong", "message", "upgrade", "noop"}
+	if int(t) < len(names) {
+		return names[t]
+	}
+	return "unknown"
+}
+
+// Packet is an Engine.IO packet
+type Packet struct {
+	Type EngineType
+	// Payload of the packet
+	Data []byte
+	// True if the packet was (or should be) sent as a binary WebSocket frame
+	Binary bool
+}
+
+// Handshake is the payload of the Open packet
+type Handshake struct {
+	// Session ID of the connection
+	SID      string   `json:"sid"`
+	Upgrades []string `json:"upgrades"`
+	// Interval between pings, in milliseconds
+	PingInterval int `json:"pingInterval"`
+	// Time to wait for a ping or pong, in milliseconds
+	PingTimeout int `json:"pingTimeout"`
+	// Largest payload the server accepts, only sent by v4 servers
+	MaxPayload int `json:"maxPayload,omitempty"`
+}
+
+// DecodePacket decodes an Engine.IO packet from a text WebSocket frame
+func DecodePacket(frame []byte) (Packet, error) {
+	if len(frame) == 0 {
+		return Packet{}, engineError(frame, ErrEmptyPacket)
+	}
+	t := EngineType(frame[0] - '0')
+	if frame[0] < '0' || t > Noop {
+		return Packet{}, engineError(frame, ErrUnknownType)
+	}
+	return Packet{Type: t, Data: frame[1:]}, nil
+}
+
+// DecodeBinaryPacketV3 decodes an Engine.IO v3 packet from a binary WebSocket frame.
+// The first byte of the frame holds the packet type as a raw number
+func DecodeBinaryPacketV3(frame []byte) (Packet, error) {
+	if len(frame) == 0 {
+		return Packet{}, engineError(frame, ErrEmptyPacket)
+	}
+	t := EngineType(frame[0])
+	if t > Noop {
+		return Packet{}, engineError(frame, ErrUnknownType)
+	}
+	return Packet{Type: t, Data: frame[1:], Binary: true}, nil
+}
+
+// DecodeBinaryPacketV4 decodes an Engine.IO v4 packet from a binary WebSocket frame.
+// Binary frames are always messages and carry no packet type
+func DecodeBinaryPacketV4(frame []byte) (Packet, error) {
+	return Packet{Type: Message, Data: frame, Binary: true}, nil
+}
+
+// Encode encodes the packet as a text WebSocket frame
+func (p Packet) Encode() []byte {
+	return append([]byte{'0' + byte(p.Type)}, p.Data...)
+}
+
+// EncodeBinaryV3 encodes the packet as an Engine.IO v3 binary WebSocket frame
+func (p Packet) EncodeBinaryV3() []byte {
+	return append([]byte{byte(p.Type)}, p.Data...)
+}
+
+// EncodeBinaryV4 encodes the packet as an Engine.IO v4 binary WebSocket frame
+func (p Packet) EncodeBinaryV4() []byte {
+	return append([]byte(nil), p.Data...)
+}
+
+// DecodeHandshake decodes the Handshake carried by an Open packet
+func DecodeHandshake(p Packet) (Handshake, error) {
+	h := Handshake{}
+	if p.Type != Open {
+		return h, engineError(p.Encode(), ErrUnexpectedType)
+	}
+	if err := json.Unmarshal(p.Data, &h); err != nil {
+		return h, engineError(p.Encode(), ErrInvalidPayload)
+	}
+	return h, nil
+}
+
+// EncodeHandshake encodes an Open packet carrying the Handshake
+func EncodeHandshake(h Handshake) []byte {
+	if h.Upgrades == nil {
+		h.Upgrades = []string{}
+	}
+	data, _ := json.Marshal(h)
+	return Packet{Type: Open, Data: data}.Encode()
+}
@@ -0,0 +1,112 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	for typ := Open; typ <= Noop; typ++ {
+		for _, data := range [][]byte{{}, []byte("probe"), []byte(`2["chat_message","hi"]`)} {
+			p := Packet{Type: typ, Data: data}
+
+			text := p.Encode()
+			got, err := DecodePacket(text)
+			if err != nil {
+				t.Fatalf("DecodePacket(%q): %v", text, err)
+			}
+			if got.Type != typ || !bytes.Equal(got.Data, data) || got.Binary {
+				t.Errorf("DecodePacket(%q) = %+v, want %+v", text, got, p)
+			}
+
+			v3 := p.EncodeBinaryV3()
+			got, err = DecodeBinaryPacketV3(v3)
+			if err != nil {
+				t.Fatalf("DecodeBinaryPacketV3(%v): %v", v3, err)
+			}
+			if got.Type != typ || !bytes.Equal(got.Data, data) || !got.Binary {
+				t.Errorf("DecodeBinaryPacketV3(%v) = %+v, want %+v", v3, got, p)
+			}
+		}
+	}
+
+	// v4 binary frames are always messages
+	data := []byte{0, 1, 2, 255}
+	got, err := DecodeBinaryPacketV4(Packet{Type: Message, Data: data}.EncodeBinaryV4())
+	if err != nil || got.Type != Message || !bytes.Equal(got.Data, data) || !got.Binary {
+		t.Errorf("DecodeBinaryPacketV4 = %+v, %v", got, err)
+	}
+}
+
+func TestDecodePacketErrors(t *testing.T) {
+	tests := []struct {
+		frame []byte
+		want  error
+	}{
+		{nil, ErrEmptyPacket},
+		{[]byte("7"), ErrUnknownType},
+		{[]byte("x"), ErrUnknownType},
+		{[]byte("/"), ErrUnknownType},
+	}
+	for _, tt := range tests {
+		_, err := DecodePacket(tt.frame)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("DecodePacket(%q) = %v, want %v", tt.frame, err, tt.want)
+		}
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) || decodeErr.Layer != "engine.io" {
+			t.Errorf("DecodePacket(%q) = %v, want an engine.io DecodeError", tt.frame, err)
+		}
+	}
+
+	if _, err := DecodeBinaryPacketV3([]byte{7}); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("DecodeBinaryPacketV3 = %v, want %v", err, ErrUnknownType)
+	}
+}
+
+func TestHandshakeRoundTrip(t *testing.T) {
+	h := Handshake{SID: "abc", Upgrades: []string{}, PingInterval: 25000, PingTimeout: 60000, MaxPayload: 1000000}
+	p, err := DecodePacket(EncodeHandshake(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeHandshake(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Errorf("DecodeHandshake = %+v, want %+v", got, h)
+	}
+
+	if _, err := DecodeHandshake(Packet{Type: Message, Data: []byte("{}")}); !errors.Is(err, ErrUnexpectedType) {
+		t.Errorf("DecodeHandshake of a message = %v, want %v", err, ErrUnexpectedType)
+	}
+	if _, err := DecodeHandshake(Packet{Type: Open, Data: []byte("{")}); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("DecodeHandshake of bad JSON = %v, want %v", err, ErrInvalidPayload)
+	}
+}
+
+func FuzzDecodePacket(f *testing.F) {
+	for _, seed := range []string{"", "0{\"sid\":\"abc\"}", "2probe", "3", "42[\"ping\"]", "6", "7", "x"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		p, err := DecodePacket(frame)
+		if err != nil {
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("DecodePacket(%q) returned %T, want *DecodeError", frame, err)
+			}
+			return
+		}
+		if encoded := p.Encode(); !bytes.Equal(encoded, frame) {
+			t.Fatalf("Encode(DecodePacket(%q)) = %q", frame, encoded)
+		}
+		if p.Type == Open {
+			// Must not panic on arbitrary payloads
+			DecodeHandshake(p)
+		}
+	})
+}
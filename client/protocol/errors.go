@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrEmptyPacket is returned when decoding an empty packet
+	ErrEmptyPacket = errors.New("Error: Empty packet")
+	// ErrUnknownType is returned when a packet starts with an unknown packet type
+	ErrUnknownType = errors.New("Error: Unknown packet type")
+	// ErrInvalidAttachments is returned when the attachment count of a binary packet is malformed
+	ErrInvalidAttachments = errors.New("Error: Invalid attachment count")
+	// ErrInvalidID is returned when the acknowledgement ID of a packet is malformed
+	ErrInvalidID = errors.New("Error: Invalid packet ID")
+	// ErrInvalidPayload is returned when the payload of a packet is not valid for its type
+	ErrInvalidPayload = errors.New("Error: Invalid packet payload")
+	// ErrUnexpectedType is returned when a packet has a valid type, but not the one expected
+	ErrUnexpectedType = errors.New("Error: Unexpected packet type")
+)
+
+// DecodeError describes a packet which could not be decoded
+type DecodeError struct {
+	// Protocol layer which failed, "engine.io" or "socket.io"
+	Layer string
+	// The packet which could not be decoded
+	Packet []byte
+	// One of the sentinel errors of this package
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	packet := string(e.Packet)
+	if len(packet) > 64 {
+		packet = packet[:64] + "..."
+	}
+	return fmt.Sprintf("%v (%v packet %q)", e.Err, e.Layer, packet)
+}
+
+// Unwrap returns the sentinel error, so callers can use errors.Is
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func engineError(packet []byte, err error) error {
+	return &DecodeError{Layer: "engine.io", Packet: packet, Err: err}
+}
+
+func socketError(packet []byte, err error) error {
+	return &DecodeError{Layer: "socket.io", Packet: packet, Err: err}
+}
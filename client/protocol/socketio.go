@@ -0,0 +1,240 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// SocketType is the type of a socket.io packet
+type SocketType byte
+
+const (
+	// Connect connects to a namespace. v4 servers reply with a payload holding the session ID
+	Connect SocketType = iota
+	// Disconnect leaves a namespace
+	Disconnect
+	// Event carries an event name and its arguments
+	Event
+	// Ack acknowledges an Event sent with an ID
+	Ack
+	// Error reports a failure to connect to a namespace
+	Error
+	// BinaryEvent is an Event with binary attachments
+	BinaryEvent
+	// BinaryAck is an Ack with binary attachments
+	BinaryAck
+)
+
+func (t SocketType) String() string {
+	names := []string{"connect", "disconnect", "event", "ack", "error", "binary event", "binary ack"}
+	if int(t) < len(names) {
+		return names[t]
+	}
+	return "unknown"
+}
+
+// DefaultNamespace is the namespace used when a packet names none
+const DefaultNamespace = "/"
+
+// SocketPacket is a socket.io packet, carried by an Engine.IO Message packet.
+//
+// It is encoded as `<type>[<attachments>-][<namespace>,][<id>][<json data>]`
+type SocketPacket struct {
+	Type SocketType
+	// Namespace of the packet, DefaultNamespace if empty
+	Namespace string
+	// True if the packet carries an acknowledgement ID
+	HasID bool
+	// Acknowledgement ID, only meaningful if HasID is set
+	ID int
+	// Number of binary attachments following a BinaryEvent or BinaryAck
+	Attachments int
+	// JSON payload of the packet: an array for events and acks, an object for connect and error
+	Data json.RawMessage
+}
+
+// NewEvent builds an Event packet for the default namespace
+func NewEvent(name string, args ...interface{}) (SocketPacket, error) {
+	data, err := json.Marshal(append([]interface{}{name}, args...))
+	if err != nil {
+		return SocketPacket{}, err
+	}
+	return SocketPacket{Type: Event, Data: data}, nil
+}
+
+// NewAck builds an Ack packet for the default namespace, answering the Event with the given ID
+func NewAck(id int, args ...interface{}) (SocketPacket, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return SocketPacket{}, err
+	}
+	return SocketPacket{Type: Ack, HasID: true, ID: id, Data: data}, nil
+}
+
+// WithID returns a copy of the packet carrying the acknowledgement ID
+func (p SocketPacket) WithID(id int) SocketPacket {
+	p.HasID = true
+	p.ID = id
+	return p
+}
+
+// EventName returns the name of an Event or BinaryEvent packet
+func (p SocketPacket) EventName() string {
+	name := ""
+	data := []interface{}{&name}
+	json.Unmarshal(p.Data, &data)
+	return name
+}
+
+// Args returns the arguments of an Event packet (without the name), or of an Ack packet
+func (p SocketPacket) Args() []json.RawMessage {
+	var args []json.RawMessage
+	json.Unmarshal(p.Data, &args)
+	if (p.Type == Event || p.Type == BinaryEvent) && len(args) > 0 {
+		return args[1:]
+	}
+	return args
+}
+
+// Encode encodes the socket.io packet as the payload of an Engine.IO Message packet
+func (p SocketPacket) Encode() []byte {
+	var b bytes.Buffer
+	b.WriteByte('0' + byte(p.Type))
+	if p.Type == BinaryEvent || p.Type == BinaryAck {
+		b.WriteString(strconv.Itoa(p.Attachments))
+		b.WriteByte('-')
+	}
+	if p.Namespace != "" && p.Namespace != DefaultNamespace {
+		b.WriteString(p.Namespace)
+		b.WriteByte(',')
+	}
+	if p.HasID {
+		b.WriteString(strconv.Itoa(p.ID))
+	}
+	b.Write(p.Data)
+	return b.Bytes()
+}
+
+// DecodeSocketPacket decodes a socket.io packet from the payload of an Engine.IO Message packet
+func DecodeSocketPacket(data []byte) (SocketPacket, error) {
+	p := SocketPacket{Namespace: DefaultNamespace}
+	if len(data) == 0 {
+		return SocketPacket{}, socketError(data, ErrEmptyPacket)
+	}
+	p.Type = SocketType(data[0] - '0')
+	if data[0] < '0' || p.Type > BinaryAck {
+		return SocketPacket{}, socketError(data, ErrUnknownType)
+	}
+	i := 1
+
+	// Attachment count of binary packets, terminated by `-`
+	if p.Type == BinaryEvent || p.Type == BinaryAck {
+		start := i
+		for i < len(data) && isDigit(data[i]) {
+			i++
+		}
+		if i == start || i >= len(data) || data[i] != '-' {
+			return SocketPacket{}, socketError(data, ErrInvalidAttachments)
+		}
+		n, err := strconv.Atoi(string(data[start:i]))
+		if err != nil {
+			return SocketPacket{}, socketError(data, ErrInvalidAttachments)
+		}
+		p.Attachments = n
+		i++
+	}
+
+	// Namespace, terminated by `,` unless it ends the packet
+	if i < len(data) && data[i] == '/' {
+		end := bytes.IndexByte(data[i:], ',')
+		if end < 0 {
+			p.Namespace = string(data[i:])
+			i = len(data)
+		} else {
+			p.Namespace = string(data[i : i+end])
+			i += end + 1
+		}
+	}
+
+	// Acknowledgement ID
+	start := i
+	for i < len(data) && isDigit(data[i]) {
+		i++
+	}
+	if i > start {
+		id, err := strconv.Atoi(string(data[start:i]))
+		if err != nil {
+			return SocketPacket{}, socketError(data, ErrInvalidID)
+		}
+		p.HasID = true
+		p.ID = id
+	}
+
+	if i < len(data) {
+		p.Data = json.RawMessage(data[i:])
+	}
+	if err := p.validate(); err != nil {
+		return SocketPacket{}, socketError(data, err)
+	}
+	return p, nil
+}
+
+// Checks that the payload has the shape required by the packet type
+func (p SocketPacket) validate() error {
+	if len(p.Data) > 0 && !json.Valid(p.Data) {
+		return ErrInvalidPayload
+	}
+	switch p.Type {
+	case Event, BinaryEvent:
+		var args []json.RawMessage
+		if json.Unmarshal(p.Data, &args) != nil || len(args) == 0 {
+			return ErrInvalidPayload
+		}
+		var name string
+		if json.Unmarshal(args[0], &name) != nil {
+			return ErrInvalidPayload
+		}
+	case Ack, BinaryAck:
+		if !p.HasID {
+			return ErrInvalidID
+		}
+		var args []json.RawMessage
+		if json.Unmarshal(p.Data, &args) != nil {
+			return ErrInvalidPayload
+		}
+	case Connect:
+		if len(p.Data) > 0 {
+			var obj map[string]json.RawMessage
+			if json.Unmarshal(p.Data, &obj) != nil {
+				return ErrInvalidPayload
+			}
+		}
+	}
+	return nil
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// DecodeMessage decodes a text WebSocket frame holding an Engine.IO Message packet and the
+// socket.io packet it carries
+func DecodeMessage(frame []byte) (SocketPacket, error) {
+	p, err := DecodePacket(frame)
+	if err != nil {
+		return SocketPacket{}, err
+	}
+	if p.Type != Message {
+		return SocketPacket{}, engineError(frame, ErrUnexpectedType)
+	}
+	return DecodeSocketPacket(p.Data)
+}
+
+// EncodeMessage encodes a socket.io packet as a text WebSocket frame holding an Engine.IO Message
+func EncodeMessage(p SocketPacket) []byte {
+	return Packet{Type: Message, Data: p.Encode()}.Encode()
+}
@@ -0,0 +1,162 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSocketPacketRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  SocketPacket
+		encoded string
+	}{
+		{"connect", SocketPacket{Type: Connect}, "0"},
+		{"connect with payload", SocketPacket{Type: Connect, Data: json.RawMessage(`{"sid":"abc"}`)}, `0{"sid":"abc"}`},
+		{"connect to namespace", SocketPacket{Type: Connect, Namespace: "/admin"}, "0/admin,"},
+		{"disconnect", SocketPacket{Type: Disconnect}, "1"},
+		{"disconnect from namespace", SocketPacket{Type: Disconnect, Namespace: "/admin"}, "1/admin,"},
+		{"event", SocketPacket{Type: Event, Data: json.RawMessage(`["ping"]`)}, `2["ping"]`},
+		{"event with args", SocketPacket{Type: Event, Data: json.RawMessage(`["attack",1,2,false,3]`)}, `2["attack",1,2,false,3]`},
+		{"event with ID", SocketPacket{Type: Event, HasID: true, ID: 12, Data: json.RawMessage(`["get_username","u"]`)}, `212["get_username","u"]`},
+		{"event in namespace", SocketPacket{Type: Event, Namespace: "/admin", Data: json.RawMessage(`["ping"]`)}, `2/admin,["ping"]`},
+		{"event in namespace with ID", SocketPacket{Type: Event, Namespace: "/admin", HasID: true, ID: 7, Data: json.RawMessage(`["ping"]`)}, `2/admin,7["ping"]`},
+		{"ack", SocketPacket{Type: Ack, HasID: true, ID: 12, Data: json.RawMessage(`["[Bot]me"]`)}, `312["[Bot]me"]`},
+		{"empty ack", SocketPacket{Type: Ack, HasID: true, ID: 0, Data: json.RawMessage(`[]`)}, `30[]`},
+		{"ack in namespace", SocketPacket{Type: Ack, Namespace: "/admin", HasID: true, ID: 3, Data: json.RawMessage(`[]`)}, `3/admin,3[]`},
+		{"error", SocketPacket{Type: Error, Data: json.RawMessage(`"Not authorized"`)}, `4"Not authorized"`},
+		{"error object", SocketPacket{Type: Error, Data: json.RawMessage(`{"message":"Not authorized"}`)}, `4{"message":"Not authorized"}`},
+		{"binary event", SocketPacket{Type: BinaryEvent, Attachments: 1, Data: json.RawMessage(`["upload",{"_placeholder":true,"num":0}]`)}, `51-["upload",{"_placeholder":true,"num":0}]`},
+		{"binary event with ID in namespace", SocketPacket{Type: BinaryEvent, Namespace: "/admin", HasID: true, ID: 4, Attachments: 2, Data: json.RawMessage(`["x"]`)}, `52-/admin,4["x"]`},
+		{"binary ack", SocketPacket{Type: BinaryAck, HasID: true, ID: 9, Attachments: 1, Data: json.RawMessage(`[{"_placeholder":true,"num":0}]`)}, `61-9[{"_placeholder":true,"num":0}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tt.packet.Encode()); got != tt.encoded {
+				t.Errorf("Encode() = %q, want %q", got, tt.encoded)
+			}
+
+			got, err := DecodeSocketPacket([]byte(tt.encoded))
+			if err != nil {
+				t.Fatalf("DecodeSocketPacket(%q): %v", tt.encoded, err)
+			}
+			want := tt.packet
+			if want.Namespace == "" {
+				want.Namespace = DefaultNamespace
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("DecodeSocketPacket(%q) = %+v, want %+v", tt.encoded, got, want)
+			}
+
+			// Carried by an Engine.IO message
+			got, err = DecodeMessage(EncodeMessage(tt.packet))
+			if err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("DecodeMessage(EncodeMessage()) = %+v, %v, want %+v", got, err, want)
+			}
+		})
+	}
+}
+
+func TestDecodeDefaultNamespace(t *testing.T) {
+	// An explicit default namespace decodes like an omitted one
+	for _, encoded := range []string{`2["ping"]`, `2/,["ping"]`} {
+		p, err := DecodeSocketPacket([]byte(encoded))
+		if err != nil {
+			t.Fatalf("DecodeSocketPacket(%q): %v", encoded, err)
+		}
+		if p.Namespace != DefaultNamespace || p.EventName() != "ping" {
+			t.Errorf("DecodeSocketPacket(%q) = %+v", encoded, p)
+		}
+		if got := string(p.Encode()); got != `2["ping"]` {
+			t.Errorf("Encode() = %q, want the namespace omitted", got)
+		}
+	}
+}
+
+func TestDecodeSocketPacketErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want error
+	}{
+		{"", ErrEmptyPacket},
+		{"7", ErrUnknownType},
+		{"/", ErrUnknownType},
+		{"5", ErrInvalidAttachments},
+		{"5-", ErrInvalidAttachments},
+		{"51", ErrInvalidAttachments},
+		{`399999999999999999999999[]`, ErrInvalidID},
+		{"3[]", ErrInvalidID},
+		{"2", ErrInvalidPayload},
+		{"2[]", ErrInvalidPayload},
+		{"2[1]", ErrInvalidPayload},
+		{`2["ping"`, ErrInvalidPayload},
+		{`2{"a":1}`, ErrInvalidPayload},
+		{"31{}", ErrInvalidPayload},
+		{"0[]", ErrInvalidPayload},
+	}
+	for _, tt := range tests {
+		_, err := DecodeSocketPacket([]byte(tt.data))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("DecodeSocketPacket(%q) = %v, want %v", tt.data, err, tt.want)
+		}
+	}
+
+	if _, err := DecodeMessage([]byte(`2["ping"]`)); !errors.Is(err, ErrUnexpectedType) {
+		t.Errorf("DecodeMessage of a ping = %v, want %v", err, ErrUnexpectedType)
+	}
+}
+
+func TestEventHelpers(t *testing.T) {
+	p, err := NewEvent("attack", 1, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = p.WithID(5)
+	if got := string(p.Encode()); got != `25["attack",1,2,false]` {
+		t.Errorf("Encode() = %q", got)
+	}
+	if p.EventName() != "attack" || len(p.Args()) != 3 || string(p.Args()[0]) != "1" {
+		t.Errorf("EventName() = %q, Args() = %q", p.EventName(), p.Args())
+	}
+
+	ack, err := NewAck(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(ack.Encode()); got != "35[]" {
+		t.Errorf("NewAck(5).Encode() = %q", got)
+	}
+}
+
+func FuzzDecodeSocketPacket(f *testing.F) {
+	for _, seed := range []string{
+		"0", `0{"sid":"abc"}`, "0/admin,", "1", `2["ping"]`, `212["get_username","u"]`, `2/admin,7["ping"]`,
+		`312["[Bot]me"]`, `4"error"`, `51-["upload",{"_placeholder":true,"num":0}]`, `61-9[]`, "5", "2/,", "",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := DecodeSocketPacket(data)
+		if err != nil {
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("DecodeSocketPacket(%q) returned %T, want *DecodeError", data, err)
+			}
+			return
+		}
+		// Whatever decodes must encode to a packet which decodes the same
+		encoded := p.Encode()
+		again, err := DecodeSocketPacket(encoded)
+		if err != nil {
+			t.Fatalf("DecodeSocketPacket(%q) = %+v, but its encoding %q fails: %v", data, p, encoded, err)
+		}
+		if !reflect.DeepEqual(again, p) {
+			t.Fatalf("DecodeSocketPacket(%q) = %+v, but its encoding %q decodes to %+v", data, p, encoded, again)
+		}
+		// Must not panic on any decoded packet
+		p.EventName()
+		p.Args()
+	})
+}
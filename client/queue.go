@@ -0,0 +1,164 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Queue adds types and utility functions for joining the matchmaking queues on Generals.io.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// QueueKind is the kind of matchmaking queue
+type QueueKind int
+
+const (
+	// Queue1v1 is the ranked 1v1 queue
+	Queue1v1 QueueKind = iota + 1
+	// QueueFFA is the free for all queue
+	QueueFFA
+	// QueueTeam is the 2v2 team queue
+	QueueTeam
+)
+
+func (k QueueKind) String() string {
+	switch k {
+	case Queue1v1:
+		return "1v1"
+	case QueueFFA:
+		return "FFA"
+	case QueueTeam:
+		return "2v2"
+	}
+	return fmt.Sprintf("QueueKind(%d)", int(k))
+}
+
+// Queue is the state of the matchmaking queue we are waiting in
+type Queue struct {
+	Kind QueueKind
+	// ID of the team we joined, only set for QueueTeam
+	TeamID string
+	// Number of players waiting in the queue
+	NumPlayers int
+	// Number of players voting to force a start
+	NumForce int
+	// True if we are voting to force a start
+	IsForcing bool
+}
+
+// queueState guards the queue the client is waiting in
+type queueState struct {
+	mu    sync.Mutex
+	queue *Queue
+}
+
+// Queue update sent by the server while we wait in a matchmaking queue
+type queueStatus struct {
+	NumPlayers *int     `json:"numPlayers"`
+	NumForce   int      `json:"numForce"`
+	IsForcing  bool     `json:"isForcing"`
+	Usernames  []string `json:"usernames"`
+}
+
+// Queue returns a copy of the matchmaking queue we are waiting in, or nil if we are not in one
+func (c *Client) Queue() *Queue {
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+	if c.queue.queue == nil {
+		return nil
+	}
+	q := *c.queue.queue
+	return &q
+}
+
+// Join1v1 joins the 1v1 queue.
+// It blocks until the server confirms we are queued or a game starts, or the context is done.
+func (c *Client) Join1v1(ctx context.Context) error {
+	return c.joinQueue(ctx, &Queue{Kind: Queue1v1})
+}
+
+// JoinFFA joins the free for all queue.
+// It blocks until the server confirms we are queued or a game starts, or the context is done.
+func (c *Client) JoinFFA(ctx context.Context) error {
+	return c.joinQueue(ctx, &Queue{Kind: QueueFFA})
+}
+
+// JoinTeam joins the 2v2 queue with the given team.
+// It blocks until the server confirms we are queued or a game starts, or the context is done.
+func (c *Client) JoinTeam(ctx context.Context, teamID string) error {
+	if teamID == "" {
+		return ErrMissingTeamID
+	}
+	return c.joinQueue(ctx, &Queue{Kind: QueueTeam, TeamID: teamID})
+}
+
+func (c *Client) joinQueue(ctx context.Context, q *Queue) error {
+	w := c.expect("queue_update", "game_start").failOn(ErrQueue, ErrBanned, ErrInvalidUserID)
+	c.setLobby(nil)
+	c.queue.mu.Lock()
+	c.queue.queue = q
+	c.queue.mu.Unlock()
+	c.sendJoinQueue(q)
+
+	if _, err := w.wait(ctx); err != nil {
+		return fmt.Errorf("Error: Could not join the %v queue: %w", q.Kind, err)
+	}
+	c.log.Info("Joined queue", "queue", q.Kind, "user", c.user.username)
+	c.state.transitionFrom(StateInLobby, StateConnected, StateRegistered)
+	return nil
+}
+
+// Sends the join request for a queue
+func (c *Client) sendJoinQueue(q *Queue) {
+	switch q.Kind {
+	case Queue1v1:
+		c.sendEvent("join_1v1", c.user.userID)
+	case QueueFFA:
+		c.sendEvent("play", c.user.userID)
+	case QueueTeam:
+		c.sendEvent("join_team", q.TeamID, c.user.userID)
+	}
+}
+
+// CancelQueue leaves the matchmaking queue we are waiting in
+func (c *Client) CancelQueue() error {
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+	if c.queue.queue == nil {
+		return ErrNotInQueue
+	}
+
+	c.sendEvent("cancel")
+	c.queue.queue = nil
+	c.state.transitionFrom(StateRegistered, StateInLobby)
+	return nil
+}
+
+// Records queue updates while we wait in a matchmaking queue
+func (c *Client) handleQueueUpdate(raw json.RawMessage) {
+	status := queueStatus{}
+	decode := []interface{}{nil, &status}
+	json.Unmarshal(raw, &decode)
+
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+	q := c.queue.queue
+	if q == nil {
+		return
+	}
+	if status.NumPlayers != nil {
+		q.NumPlayers = *status.NumPlayers
+	} else {
+		q.NumPlayers = len(status.Usernames)
+	}
+	q.NumForce = status.NumForce
+	q.IsForcing = status.IsForcing
+}
+
+// Leaves the queue once a game has been found
+func (c *Client) handleQueueGameStart(json.RawMessage) {
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+	c.queue.queue = nil
+}
@@ -0,0 +1,137 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/brisberg/generals-io-bot/client"
+	"github.com/brisberg/generals-io-bot/client/fakeserver"
+)
+
+// Returns a context which is cancelled after the timeout or when the test ends
+func ctxWithTimeout(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// Registers user1 and joins a queue with the given request
+func joinQueue(t *testing.T, c *client.Client, join func(c *client.Client) error) {
+	t.Helper()
+	if err := c.RegisterBot(ctxWithTimeout(t), "user1", "[Bot]one"); err != nil {
+		t.Fatalf("RegisterBot: %v", err)
+	}
+	if err := join(c); err != nil {
+		t.Fatalf("joining the queue: %v", err)
+	}
+}
+
+func TestJoinQueues(t *testing.T) {
+	tests := []struct {
+		join   func(c *client.Client) error
+		kind   client.QueueKind
+		teamID string
+		queue  string
+	}{
+		{func(c *client.Client) error { return c.Join1v1(ctxWithTimeout(t)) }, client.Queue1v1, "", "join_1v1"},
+		{func(c *client.Client) error { return c.JoinFFA(ctxWithTimeout(t)) }, client.QueueFFA, "", "play"},
+		{func(c *client.Client) error { return c.JoinTeam(ctxWithTimeout(t), "team1") }, client.QueueTeam, "team1", "join_team:team1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind.String(), func(t *testing.T) {
+			s := fakeserver.New()
+			defer s.Close()
+			s.SetUsername("user1", "[Bot]one")
+			c := runClient(t, s, client.Options{})
+			joinQueue(t, c, tt.join)
+
+			if got := s.Queued(tt.queue); !reflect.DeepEqual(got, []string{"user1"}) {
+				t.Errorf("queued on the server = %v, want [user1]", got)
+			}
+			q := c.Queue()
+			if q == nil || q.Kind != tt.kind || q.TeamID != tt.teamID || q.NumPlayers != 1 {
+				t.Errorf("Queue() = %+v, want one player in the %v queue", q, tt.kind)
+			}
+
+			if err := c.CancelQueue(); err != nil {
+				t.Fatalf("CancelQueue: %v", err)
+			}
+			if _, err := s.Next("cancel", timeout); err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Queued(tt.queue); len(got) != 0 {
+				t.Errorf("queued on the server after cancelling = %v", got)
+			}
+			if q := c.Queue(); q != nil {
+				t.Errorf("Queue() = %+v after cancelling, want nil", q)
+			}
+			if err := c.CancelQueue(); !errors.Is(err, client.ErrNotInQueue) {
+				t.Errorf("CancelQueue twice = %v, want %v", err, client.ErrNotInQueue)
+			}
+		})
+	}
+}
+
+func TestJoinTeamWithoutTeam(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	c := runClient(t, s, client.Options{})
+	if err := c.JoinTeam(ctxWithTimeout(t), ""); !errors.Is(err, client.ErrMissingTeamID) {
+		t.Errorf("JoinTeam without a team = %v, want %v", err, client.ErrMissingTeamID)
+	}
+}
+
+func TestQueueUpdateCountsUsernames(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	s.SetUsername("user1", "[Bot]one")
+	// Older servers list the queued players instead of counting them
+	s.Handle("play", func(conn *fakeserver.Conn, e fakeserver.Event) {
+		conn.Emit("queue_update", map[string]interface{}{
+			"usernames": []string{"[Bot]one", "two", "three"},
+			"numForce":  2,
+			"isForcing": true,
+		})
+	})
+	c := runClient(t, s, client.Options{})
+	joinQueue(t, c, func(c *client.Client) error { return c.JoinFFA(ctxWithTimeout(t)) })
+
+	if q := c.Queue(); q == nil || q.NumPlayers != 3 || q.NumForce != 2 || !q.IsForcing {
+		t.Errorf("Queue() = %+v, want 3 players and 2 forcing", q)
+	}
+}
+
+func TestJoinQueueServerError(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	s.SetUsername("user1", "[Bot]one")
+	s.Handle("join_1v1", func(conn *fakeserver.Conn, e fakeserver.Event) {
+		conn.Emit("error_banned", "You are banned from matchmaking.")
+	})
+	reported := make(chan *client.ServerError, 1)
+	c, _ := runReconnecting(t, s, 0, func(c *client.Client) {
+		c.OnServerError = func(err *client.ServerError) { reported <- err }
+	})
+	if err := c.RegisterBot(ctxWithTimeout(t), "user1", "[Bot]one"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := c.Join1v1(ctxWithTimeout(t))
+	if !errors.Is(err, client.ErrBanned) {
+		t.Errorf("Join1v1 = %v, want %v", err, client.ErrBanned)
+	}
+	var serverErr *client.ServerError
+	if !errors.As(err, &serverErr) || serverErr.Event != "error_banned" || serverErr.Message != "You are banned from matchmaking." {
+		t.Errorf("Join1v1 = %#v, want the server's error event", err)
+	}
+	select {
+	case e := <-reported:
+		if e.Err != client.ErrBanned {
+			t.Errorf("OnServerError(%v), want %v", e, client.ErrBanned)
+		}
+	default:
+		t.Error("OnServerError was not called")
+	}
+}
@@ -0,0 +1,118 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Reconnect adds automatic redialing of the server when the WebSocket connection is lost.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventResync is a synthetic event sent to GameEvents (and the registered handlers) after the
+// client reconnected during a game. The game state must discard its previous map, since the
+// server will send the full map again in the next game_update.
+const EventResync = "resync"
+
+// ReconnectPolicy controls how the client redials the server after losing its connection
+type ReconnectPolicy struct {
+	// Maximum number of attempts before giving up. 0 means retry forever
+	MaxAttempts int
+	// Delay before the first attempt
+	InitialBackoff time.Duration
+	// Upper bound for the delay between attempts
+	MaxBackoff time.Duration
+	// Factor the delay is multiplied by after each failed attempt
+	Multiplier float64
+}
+
+// DefaultReconnectPolicy returns a policy retrying forever, backing off from 500ms up to 30s
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+// Returns the delay to wait after a failed attempt which was preceded by the given delay
+func (p *ReconnectPolicy) nextBackoff(prev time.Duration) time.Duration {
+	next := time.Duration(float64(prev) * p.Multiplier)
+	if next < p.InitialBackoff {
+		next = p.InitialBackoff
+	}
+	if p.MaxBackoff > 0 && next > p.MaxBackoff {
+		next = p.MaxBackoff
+	}
+	return next
+}
+
+// Redials the server with exponential backoff until a connection is established, the policy
+// runs out of attempts, the client is closed or the context is done
+func (c *Client) reconnect(ctx context.Context, cause error) error {
+	c.log.Warn("Connection lost", "err", cause)
+	c.dropConn()
+	c.acks.failAll(ErrConnectionLost)
+	prev := c.State()
+	c.state.transition(StateDialing)
+
+	policy := c.ReconnectPolicy
+	backoff := policy.InitialBackoff
+	for attempt := 1; policy.MaxAttempts == 0 || attempt <= policy.MaxAttempts; attempt++ {
+		select {
+		case <-time.After(backoff):
+		case <-c.closed:
+			return ErrClientClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		c.log.Info("Reconnecting", "attempt", attempt)
+		conn, config, err := dial(ctx, &c.options)
+		if c.OnReconnect != nil {
+			c.OnReconnect(attempt, err)
+		}
+		if err != nil {
+			backoff = policy.nextBackoff(backoff)
+			continue
+		}
+
+		c.setConn(conn, config)
+		if prev == StateInGame {
+			// Resync on the read loop, so the game discards its map before the next update arrives
+			c.state.transition(StateInGame)
+			c.resyncGame()
+		}
+		// Rejoin in the background, the replies are delivered by the read loop
+		go c.rejoin(ctx, prev)
+		return nil
+	}
+	return fmt.Errorf("Error: Could not reconnect after %v attempts: %w", policy.MaxAttempts, cause)
+}
+
+// Registers our user again and rejoins the lobby or game we were in before the connection dropped
+func (c *Client) rejoin(ctx context.Context, prev State) {
+	if c.user.userID != "" {
+		if err := c.RegisterBot(ctx, c.user.userID, c.user.username); err != nil {
+			c.log.Warn("Error re-registering after reconnect", "user", c.user.username, "err", err)
+		}
+	}
+
+	if l := c.Lobby(); l != nil {
+		// The server puts us back into the custom lobby, or the game running in it
+		c.sendEvent("join_private", l.ID, c.user.userID)
+		c.state.transition(prev)
+	} else if q := c.Queue(); q != nil && prev != StateInGame {
+		// The server dropped us from the queue along with the connection
+		c.sendJoinQueue(q)
+		c.state.transition(prev)
+	}
+}
+
+// Sends EventResync to the game and the registered handlers. Must be called on the read loop
+func (c *Client) resyncGame() {
+	raw, _ := json.Marshal([]string{EventResync})
+	c.forwardGameEvent(EventResync)(raw)
+	c.events.dispatch(EventResync, raw)
+}
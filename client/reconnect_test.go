@@ -0,0 +1,179 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/client"
+	"github.com/brisberg/generals-io-bot/client/fakeserver"
+	"github.com/brisberg/generals-io-bot/logger"
+)
+
+// Game which also records resyncs
+type resyncingGame struct {
+	recordingGame
+}
+
+func (g *resyncingGame) Resync() { g.events <- "resync" }
+
+// Records the attempts reported to OnReconnect
+type reconnectLog struct {
+	mu       sync.Mutex
+	attempts []int
+	errs     []error
+}
+
+func (l *reconnectLog) record(attempt int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.attempts = append(l.attempts, attempt)
+	l.errs = append(l.errs, err)
+}
+
+func (l *reconnectLog) get() ([]int, []error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]int{}, l.attempts...), append([]error{}, l.errs...)
+}
+
+// Connects a client which reconnects quickly, configures it and runs it until the test ends.
+// The returned channel receives the error Run returns
+func runReconnecting(t *testing.T, s *fakeserver.Server, maxAttempts int, configure func(c *client.Client)) (*client.Client, <-chan error) {
+	t.Helper()
+	c, err := client.ConnectWithOptions(context.Background(), client.Options{URL: s.URL(), Logger: logger.Nop()})
+	if err != nil {
+		t.Fatalf("ConnectWithOptions: %v", err)
+	}
+	c.ReconnectPolicy = &client.ReconnectPolicy{MaxAttempts: maxAttempts, InitialBackoff: 10 * time.Millisecond, Multiplier: 2}
+	if configure != nil {
+		configure(c)
+	}
+	runErr := make(chan error, 1)
+	go func() { runErr <- c.Run(context.Background()) }()
+	t.Cleanup(func() { c.Close("Test done.") })
+	return c, runErr
+}
+
+// Registers user1 and joins lobby1, consuming the requests from the server's log
+func joinLobby1(t *testing.T, s *fakeserver.Server, c *client.Client) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := c.RegisterBot(ctx, "user1", "[Bot]one"); err != nil {
+		t.Fatalf("RegisterBot: %v", err)
+	}
+	if err := c.JoinCustomGame(ctx, "lobby1"); err != nil {
+		t.Fatalf("JoinCustomGame: %v", err)
+	}
+	for _, name := range []string{"get_username", "join_private"} {
+		if _, err := s.Next(name, timeout); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Fails the test unless the client rejoins lobby1 as user1
+func expectRejoin(t *testing.T, s *fakeserver.Server) {
+	t.Helper()
+	if _, err := s.Next("get_username", timeout); err != nil {
+		t.Fatalf("user was not registered again: %v", err)
+	}
+	e, err := s.Next("join_private", timeout)
+	if err != nil {
+		t.Fatalf("lobby was not joined again: %v", err)
+	}
+	var lobbyID, userID string
+	e.Arg(0, &lobbyID)
+	e.Arg(1, &userID)
+	if lobbyID != "lobby1" || userID != "user1" {
+		t.Errorf("join_private %q %q, want lobby1 user1", lobbyID, userID)
+	}
+}
+
+func TestReconnectInLobby(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	s.SetUsername("user1", "[Bot]one")
+	log := &reconnectLog{}
+	c, _ := runReconnecting(t, s, 0, func(c *client.Client) { c.OnReconnect = log.record })
+	joinLobby1(t, s, c)
+
+	s.DropConnections()
+	expectRejoin(t, s)
+	if attempts, errs := log.get(); len(attempts) != 1 || attempts[0] != 1 || errs[0] != nil {
+		t.Errorf("OnReconnect calls %v %v, want one successful attempt", attempts, errs)
+	}
+	if l := s.Lobby("lobby1"); l == nil || len(l.UserIDs) != 1 || l.UserIDs[0] != "user1" {
+		t.Errorf("server lobby = %+v, want user1 in it", l)
+	}
+	if c.State() != client.StateInLobby {
+		t.Errorf("State() = %v after reconnecting, want %v", c.State(), client.StateInLobby)
+	}
+}
+
+func TestReconnectInGame(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	s.SetUsername("user1", "[Bot]one")
+	events := make(chan string, 16)
+	resyncs := make(chan bool, 1)
+	c, _ := runReconnecting(t, s, 0, func(c *client.Client) {
+		c.UseGameConstructor(func() client.IGame { return &resyncingGame{recordingGame{events: events}} })
+		c.On(client.EventResync, func(json.RawMessage) { resyncs <- true })
+	})
+	joinLobby1(t, s, c)
+
+	s.StartGame(fakeserver.GameStart{PlayerIndex: 0, ReplayID: "replay1", Usernames: []string{"[Bot]one", "other"}})
+	s.SendUpdate(fakeserver.Update{Turn: 1, Width: 2, Height: 1, Armies: []int{1, 0}, Terrain: []int{0, -1}, Generals: []int{0, -1}})
+	expectEvents(t, events, "pre_game_start", "game_start", "game_update 1")
+
+	s.DropConnections()
+	expectEvents(t, events, "resync")
+	select {
+	case <-resyncs:
+	case <-time.After(timeout):
+		t.Fatal("EventResync was not dispatched to the handlers")
+	}
+	expectRejoin(t, s)
+	if c.State() != client.StateInGame {
+		t.Errorf("State() = %v after reconnecting, want %v", c.State(), client.StateInGame)
+	}
+
+	// The new connection receives the full map again
+	s.SendUpdate(fakeserver.Update{Turn: 2, Width: 2, Height: 1, Armies: []int{2, 0}, Terrain: []int{0, -1}, Generals: []int{0, -1}})
+	expectEvents(t, events, "game_update 2")
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	log := &reconnectLog{}
+	_, runErr := runReconnecting(t, s, 3, func(c *client.Client) { c.OnReconnect = log.record })
+	// Give the read loop time to start on the connection
+	time.Sleep(50 * time.Millisecond)
+
+	// Every attempt fails once the server is gone
+	s.Close()
+	select {
+	case err := <-runErr:
+		if err == nil || !strings.Contains(err.Error(), "Could not reconnect after 3 attempts") {
+			t.Errorf("Run = %v, want an error giving up after 3 attempts", err)
+		}
+	case <-time.After(timeout):
+		t.Fatal("Run did not give up reconnecting")
+	}
+
+	attempts, errs := log.get()
+	if len(attempts) != 3 {
+		t.Fatalf("OnReconnect called %v times, want 3", len(attempts))
+	}
+	for i := range attempts {
+		if attempts[i] != i+1 || errs[i] == nil {
+			t.Errorf("attempt %v reported as %v, %v, want a failed attempt %v", i, attempts[i], errs[i], i+1)
+		}
+	}
+}
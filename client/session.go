@@ -0,0 +1,215 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Session adds continuous play: leaving each finished game and rejoining the lobby or queue it was
+// played from, without tearing down the connection.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Session configures continuous play. When set, the client leaves each finished game and rejoins
+// the custom Lobby or matchmaking queue the game was played from, instead of closing.
+type Session struct {
+	// Maximum number of games to play before closing the client. 0 plays until the client is closed
+	MaxGames int
+	// Time to wait after a game before rejoining
+	RejoinDelay time.Duration
+	// Time allowed for rejoining. The client is closed if rejoining fails. 0 waits forever
+	RejoinTimeout time.Duration
+	// Vote to force start after rejoining a custom Lobby or the FFA and 2v2 queues
+	ForceStart bool
+	// Called with the result of each game, once the game has been left
+	OnGameResult func(GameResult)
+}
+
+// GameResult is the outcome of a game played by the client
+type GameResult struct {
+	// Number of the game on this client, starting at 1
+	Number int
+	// ID of the replay on Generals.io
+	ReplayID string
+	// True if we won the game
+	Won bool
+	// ID of the custom Lobby the game was played in, empty for matchmaking games
+	LobbyID string
+	// Matchmaking queue the game was found in, nil for custom games
+	Queue *Queue
+	// Times the game started and ended
+	Started time.Time
+	Ended   time.Time
+}
+
+// Per game state of the client, reset after each game
+type gameState struct {
+	mu sync.Mutex
+	// Number of games started
+	played int
+	// Result of the game being played
+	result GameResult
+	// Constructor for the game instance of each game, nil if games are not managed by the client
+	newGame func() IGame
+	// Game instance of the game being played
+	game IGame
+}
+
+// Game data sent with game_start which the session keeps
+type sessionGameStart struct {
+	ReplayID string `json:"replay_id"`
+}
+
+// UseGameConstructor sets the constructor the client should use when creating new Game instances.
+// A new instance is created for every game, and receives its events before they are sent to the
+// GameEvents channel.
+func (c *Client) UseGameConstructor(cstr func() IGame) {
+	c.game.mu.Lock()
+	defer c.game.mu.Unlock()
+	c.game.newGame = cstr
+}
+
+// Game returns the game instance of the game being played, or nil if there is none.
+// Instances are only created once a constructor is set with UseGameConstructor
+func (c *Client) Game() IGame {
+	c.game.mu.Lock()
+	defer c.game.mu.Unlock()
+	return c.game.game
+}
+
+// Dispatches a game event to the game instance, creating a new instance for a new game
+func (c *Client) dispatchGame(event string, raw json.RawMessage) {
+	c.game.mu.Lock()
+	if c.game.newGame == nil {
+		c.game.mu.Unlock()
+		return
+	}
+	if event == "pre_game_start" || c.game.game == nil {
+		c.game.game = c.game.newGame()
+	}
+	g := c.game.game
+	c.game.mu.Unlock()
+
+	switch event {
+	case "pre_game_start":
+		g.PreGameStart()
+	case "game_start":
+		g.GameStart(raw)
+	case "game_update":
+		g.GameUpdate(raw)
+	case "game_won":
+		g.GameWon()
+	case "game_lost":
+		g.GameLost()
+	case "game_over":
+		g.GameOver()
+	case "chat_message":
+		if r, ok := g.(ChatReceiver); ok {
+			r.ChatMessage(raw)
+		}
+	case EventResync:
+		if r, ok := g.(Resyncer); ok {
+			r.Resync()
+		}
+	}
+}
+
+// Starts the result of a new game. Registered before the queue is cleared on game_start
+func (c *Client) handleSessionGameStart(raw json.RawMessage) {
+	start := sessionGameStart{}
+	decode := []interface{}{nil, &start}
+	json.Unmarshal(raw, &decode)
+
+	result := GameResult{
+		ReplayID: start.ReplayID,
+		Queue:    c.Queue(),
+		Started:  time.Now(),
+	}
+	if l := c.Lobby(); l != nil {
+		result.LobbyID = l.ID
+	}
+
+	c.game.mu.Lock()
+	defer c.game.mu.Unlock()
+	c.game.played++
+	result.Number = c.game.played
+	c.game.result = result
+}
+
+// Records that we won the game being played
+func (c *Client) handleSessionGameWon(json.RawMessage) {
+	c.game.mu.Lock()
+	defer c.game.mu.Unlock()
+	c.game.result.Won = true
+}
+
+// Resets the per game state once a game is over and returns its result
+func (c *Client) finishGame() GameResult {
+	c.game.mu.Lock()
+	defer c.game.mu.Unlock()
+	result := c.game.result
+	result.Ended = time.Now()
+	c.game.result = GameResult{}
+	c.game.game = nil
+	return result
+}
+
+// Reports the result of the finished game, then rejoins or ends the session
+func (c *Client) continueSession(s *Session) {
+	result := c.finishGame()
+	c.log.Info("Game over", "game", result.Number, "won", result.Won, "replay", result.ReplayID)
+	if s.OnGameResult != nil {
+		s.OnGameResult(result)
+	}
+	if s.MaxGames > 0 && result.Number >= s.MaxGames {
+		c.Close(fmt.Sprintf("Session finished after %v games.", result.Number))
+		if c.GameEvents != nil {
+			close(c.GameEvents)
+		}
+		return
+	}
+	go c.rejoinSession(s, result)
+}
+
+// Rejoins the custom Lobby or matchmaking queue the finished game was played from
+func (c *Client) rejoinSession(s *Session, result GameResult) {
+	select {
+	case <-time.After(s.RejoinDelay):
+	case <-c.closed:
+		return
+	}
+
+	ctx := context.Background()
+	if s.RejoinTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.RejoinTimeout)
+		defer cancel()
+	}
+
+	var err error
+	switch {
+	case result.LobbyID != "":
+		err = c.JoinCustomGame(ctx, result.LobbyID)
+	case result.Queue != nil:
+		q := &Queue{Kind: result.Queue.Kind, TeamID: result.Queue.TeamID}
+		err = c.joinQueue(ctx, q)
+	default:
+		c.log.Warn("Session has no lobby or queue to rejoin", "game", result.Number)
+		return
+	}
+	if c.isClosed() {
+		return
+	}
+	if err != nil {
+		c.shutdown(err, fmt.Sprint("Error rejoining after game: ", err))
+		return
+	}
+
+	if s.ForceStart && (result.Queue == nil || result.Queue.Kind != Queue1v1) {
+		if err := c.SetForceStart(true); err != nil {
+			c.log.Warn("Error forcing start after rejoining", "err", err)
+		}
+	}
+}
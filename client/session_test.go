@@ -0,0 +1,103 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/client"
+	"github.com/brisberg/generals-io-bot/client/fakeserver"
+)
+
+func TestSessionRejoinsLobby(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	s.SetUsername("user1", "[Bot]one")
+	results := make(chan client.GameResult, 2)
+	c, runErr := runReconnecting(t, s, 0, func(c *client.Client) {
+		c.Session = &client.Session{
+			MaxGames:     2,
+			RejoinDelay:  10 * time.Millisecond,
+			ForceStart:   true,
+			OnGameResult: func(r client.GameResult) { results <- r },
+		}
+	})
+	joinLobby1(t, s, c)
+
+	for game := 1; game <= 2; game++ {
+		s.StartGame(fakeserver.GameStart{PlayerIndex: 0, ReplayID: "replay", Usernames: []string{"[Bot]one", "other"}})
+		s.EndGame(game == 1)
+
+		select {
+		case r := <-results:
+			if r.Number != game || r.Won != (game == 1) || r.LobbyID != "lobby1" || r.Queue != nil || r.ReplayID != "replay" {
+				t.Errorf("game %v result = %+v", game, r)
+			}
+			if r.Ended.Before(r.Started) {
+				t.Errorf("game %v ended at %v, before it started at %v", game, r.Ended, r.Started)
+			}
+		case <-time.After(timeout):
+			t.Fatalf("no result for game %v", game)
+		}
+		if game == 2 {
+			break
+		}
+
+		// The session rejoins the lobby and votes to force start
+		if e, err := s.Next("join_private", timeout); err != nil {
+			t.Fatalf("lobby was not rejoined: %v", err)
+		} else {
+			var lobbyID string
+			if e.Arg(0, &lobbyID); lobbyID != "lobby1" {
+				t.Errorf("rejoined lobby %q, want lobby1", lobbyID)
+			}
+		}
+		if _, err := s.Next("set_force_start", timeout); err != nil {
+			t.Fatalf("force start was not voted after rejoining: %v", err)
+		}
+	}
+
+	// The client closes once MaxGames have been played
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("Run = %v, want nil", err)
+		}
+	case <-time.After(timeout):
+		t.Fatal("Run did not return after the last game")
+	}
+}
+
+func TestSessionRejoinsQueue(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	s.SetUsername("user1", "[Bot]one")
+	results := make(chan client.GameResult, 1)
+	c, _ := runReconnecting(t, s, 0, func(c *client.Client) {
+		c.Session = &client.Session{OnGameResult: func(r client.GameResult) { results <- r }}
+	})
+	joinQueue(t, c, func(c *client.Client) error { return c.JoinTeam(ctxWithTimeout(t), "team1") })
+
+	s.StartGame(fakeserver.GameStart{PlayerIndex: 0, ReplayID: "replay", Usernames: []string{"[Bot]one", "other"}})
+	s.EndGame(false)
+	select {
+	case r := <-results:
+		if r.Won || r.LobbyID != "" || r.Queue == nil || r.Queue.Kind != client.QueueTeam || r.Queue.TeamID != "team1" {
+			t.Errorf("result = %+v, queue %+v", r, r.Queue)
+		}
+	case <-time.After(timeout):
+		t.Fatal("no game result")
+	}
+
+	// The team queue is joined again with the same team
+	if _, err := s.Next("join_team", timeout); err != nil {
+		t.Fatal(err)
+	}
+	e, err := s.Next("join_team", timeout)
+	if err != nil {
+		t.Fatalf("queue was not rejoined: %v", err)
+	}
+	var teamID string
+	if e.Arg(0, &teamID); teamID != "team1" {
+		t.Errorf("rejoined team %q, want team1", teamID)
+	}
+}
@@ -0,0 +1,161 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// State adds the lifecycle state machine of a Client, which supervisors can observe.
+package client
+
+import (
+	"fmt"
+	"sync"
+)
+
+// State is a step in the lifecycle of a Client
+type State int
+
+const (
+	// StateDialing means the client is dialing (or redialing) the server
+	StateDialing State = iota
+	// StateConnected means the socket.io handshake completed
+	StateConnected
+	// StateRegistered means our bot user is registered
+	StateRegistered
+	// StateInLobby means we are waiting in a custom lobby or matchmaking queue
+	StateInLobby
+	// StateInGame means we are playing a game
+	StateInGame
+	// StateClosing means Close was called and the client is shutting down
+	StateClosing
+	// StateClosed means the client is closed. This state is terminal
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDialing:
+		return "Dialing"
+	case StateConnected:
+		return "Connected"
+	case StateRegistered:
+		return "Registered"
+	case StateInLobby:
+		return "InLobby"
+	case StateInGame:
+		return "InGame"
+	case StateClosing:
+		return "Closing"
+	case StateClosed:
+		return "Closed"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// StateChange describes a transition between two states
+type StateChange struct {
+	From State
+	To   State
+}
+
+// stateMachine guards the lifecycle state of a Client and notifies subscribers of transitions
+type stateMachine struct {
+	mu      sync.Mutex
+	state   State
+	err     error
+	lastSub int
+	subs    map[int]chan StateChange
+}
+
+func newStateMachine() *stateMachine {
+	return &stateMachine{
+		state: StateDialing,
+		subs:  make(map[int]chan StateChange),
+	}
+}
+
+// Moves to the given state and notifies the subscribers.
+// Once closing, only the move to StateClosed is allowed.
+func (m *stateMachine) transition(to State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from := m.state
+	if from == to || from == StateClosed || (from == StateClosing && to != StateClosed) {
+		return
+	}
+	m.state = to
+
+	change := StateChange{From: from, To: to}
+	for _, sub := range m.subs {
+		select {
+		case sub <- change:
+		default:
+			// Subscriber is not keeping up, drop the change rather than block the client
+		}
+	}
+	if to == StateClosed {
+		for id, sub := range m.subs {
+			close(sub)
+			delete(m.subs, id)
+		}
+	}
+}
+
+// Moves to the given state only if the client is currently in one of the from states
+func (m *stateMachine) transitionFrom(to State, from ...State) {
+	m.mu.Lock()
+	current := m.state
+	m.mu.Unlock()
+
+	for _, f := range from {
+		if current == f {
+			m.transition(to)
+			return
+		}
+	}
+}
+
+// State returns the current lifecycle state of the client
+func (c *Client) State() State {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	return c.state.state
+}
+
+// Err returns the error which closed the client. It is nil while the client is open, and when the
+// client was closed deliberately with Close.
+func (c *Client) Err() error {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	return c.state.err
+}
+
+// Done returns a channel which is closed when the client starts closing
+func (c *Client) Done() <-chan bool {
+	return c.closed
+}
+
+// Subscribe returns a channel receiving every state transition of the client, and a function which
+// cancels the subscription. The channel is closed once the client reaches StateClosed.
+//
+// Transitions are dropped for subscribers which fall more than 16 transitions behind.
+func (c *Client) Subscribe() (<-chan StateChange, func()) {
+	m := c.state
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub := make(chan StateChange, 16)
+	if m.state == StateClosed {
+		close(sub)
+		return sub, func() {}
+	}
+	m.lastSub++
+	id := m.lastSub
+	m.subs[id] = sub
+
+	return sub, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.subs[id]; ok {
+			close(sub)
+			delete(m.subs, id)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package client provides utilities for interacting with Generals.io over a WebSocket connection.
+//
+// Transport adds the Engine.IO wire protocol versions the client can speak. Each version implements
+// the handshake and heartbeat behind the transport interface.
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/client/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// ProtocolVersion selects the Engine.IO wire protocol spoken with the server
+type ProtocolVersion int
+
+const (
+	// EIO3 is Engine.IO v3, used by Socket.IO v2. The client sends pings and the server replies
+	EIO3 ProtocolVersion = 3
+	// EIO4 is Engine.IO v4, used by Socket.IO v3 and v4. The server sends pings and the client replies,
+	// and the client has to connect to the default namespace explicitly
+	EIO4 ProtocolVersion = 4
+)
+
+// transport implements the parts of the wire protocol which differ between Engine.IO versions
+type transport interface {
+	// Reads the open packet and connects to the default namespace on a freshly dialed connection,
+	// recording the frames exchanged
+	handshake(conn *websocket.Conn, rec *Recorder) (*protocol.Handshake, error)
+	// Keeps the connection alive until done is closed or the client is closed.
+	// Returns false if the server stopped responding
+	heartbeat(c *Client, config *protocol.Handshake, done <-chan bool) bool
+	// Handles a ping or pong packet received from the server
+	handleHeartbeat(c *Client, p protocol.Packet)
+	// Decodes a binary WebSocket frame
+	decodeBinary(frame []byte) (protocol.Packet, error)
+}
+
+// Returns the transport for a protocol version
+func newTransport(version ProtocolVersion) (transport, error) {
+	switch version {
+	case EIO3:
+		return eio3Transport{}, nil
+	case EIO4:
+		return eio4Transport{}, nil
+	}
+	return nil, fmt.Errorf("Error: Unsupported protocol version %v", int(version))
+}
+
+// Reads the Engine.IO open packet (`0{...}`) containing the connection config
+func readOpenPacket(conn *websocket.Conn, rec *Recorder) (*protocol.Handshake, error) {
+	// Expect msg type to be `0` (open)
+	messageType, configMsg, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	rec.record(Inbound, messageType, configMsg)
+
+	p, err := protocol.DecodePacket(configMsg)
+	if err != nil {
+		return nil, err
+	}
+	config, err := protocol.DecodeHandshake(p)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Reads the socket.io connect packet confirming we joined the default namespace
+func readConnectPacket(conn *websocket.Conn, rec *Recorder) error {
+	// Expect msg type to be `40`
+	messageType, message, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	rec.record(Inbound, messageType, message)
+	p, err := protocol.DecodeMessage(message)
+	if err != nil {
+		return err
+	}
+	if p.Type != protocol.Connect {
+		return fmt.Errorf("Error: Expected '40' success type: got %v", string(message))
+	}
+	return nil
+}
+
+// eio3Transport speaks Engine.IO v3
+type eio3Transport struct{}
+
+func (eio3Transport) handshake(conn *websocket.Conn, rec *Recorder) (*protocol.Handshake, error) {
+	config, err := readOpenPacket(conn, rec)
+	if err != nil {
+		return nil, err
+	}
+
+	// The server connects us to the default namespace on its own
+	if err := readConnectPacket(conn, rec); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Set up repeated ping requests to the server
+// Respects the pingInterval and pingTimeout provided by the server when opening the connection
+// If a pong ("3") is not recieved before the timeout, the server is assumed nonresponsive
+func (eio3Transport) heartbeat(c *Client, config *protocol.Handshake, done <-chan bool) bool {
+	ticker := time.NewTicker(time.Duration(config.PingInterval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Send a ping
+			c.sendEnginePacket(protocol.Packet{Type: protocol.Ping, Data: []byte(" ping")})
+			timeout := time.After(time.Duration(config.PingTimeout) * time.Millisecond)
+			select {
+			case <-c.heartbeatc:
+				// Pong satisfied, do nothing
+			case <-timeout:
+				return false
+			case <-done:
+				return true
+			}
+		case <-done:
+			return true
+		case <-c.closed:
+			return true
+		}
+	}
+}
+
+func (eio3Transport) handleHeartbeat(c *Client, p protocol.Packet) {
+	if p.Type == protocol.Pong {
+		c.notifyHeartbeat()
+	}
+}
+
+func (eio3Transport) decodeBinary(frame []byte) (protocol.Packet, error) {
+	return protocol.DecodeBinaryPacketV3(frame)
+}
+
+// eio4Transport speaks Engine.IO v4
+type eio4Transport struct{}
+
+func (eio4Transport) handshake(conn *websocket.Conn, rec *Recorder) (*protocol.Handshake, error) {
+	config, err := readOpenPacket(conn, rec)
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect to the default namespace, the server replies with `40{"sid":...}`
+	connect := protocol.EncodeMessage(protocol.SocketPacket{Type: protocol.Connect})
+	if err := conn.WriteMessage(websocket.TextMessage, connect); err != nil {
+		return nil, err
+	}
+	rec.record(Outbound, websocket.TextMessage, connect)
+	if err := readConnectPacket(conn, rec); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Waits for the pings the server sends every pingInterval.
+// If no ping arrives within pingInterval + pingTimeout, the server is assumed nonresponsive
+func (eio4Transport) heartbeat(c *Client, config *protocol.Handshake, done <-chan bool) bool {
+	wait := time.Duration(config.PingInterval+config.PingTimeout) * time.Millisecond
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-c.heartbeatc:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(wait)
+		case <-timer.C:
+			return false
+		case <-done:
+			return true
+		case <-c.closed:
+			return true
+		}
+	}
+}
+
+func (eio4Transport) handleHeartbeat(c *Client, p protocol.Packet) {
+	if p.Type == protocol.Ping {
+		// Reply with a pong carrying the same payload
+		c.sendEnginePacket(protocol.Packet{Type: protocol.Pong, Data: p.Data})
+		c.notifyHeartbeat()
+	}
+}
+
+func (eio4Transport) decodeBinary(frame []byte) (protocol.Packet, error) {
+	return protocol.DecodeBinaryPacketV4(frame)
+}
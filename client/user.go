@@ -4,8 +4,9 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"time"
 )
 
 // User holds information about a user or botuser on Generals.io
@@ -16,11 +17,6 @@ type User struct {
 	username string
 	// rank int
 	// stars int
-
-	// Buffered Channel for the results of a get_username request
-	usernamec chan string
-	// Buffered Channel for the results of a set_username request
-	usererrc chan string
 }
 
 // RegisterBot verifies that the given UserID is associated with the resired username.
@@ -28,64 +24,62 @@ type User struct {
 //
 // This will fail if the username doesn't start with `[BOT]`, the username is already
 // taken by another user, or the given userID is already associated with a different
-// username.
-func (c *Client) RegisterBot(userID string, username string) error {
+// username. It gives up when the context is done.
+func (c *Client) RegisterBot(ctx context.Context, userID string, username string) error {
 	if userID == "" || username == "" {
-		return fmt.Errorf("Error: Must specify both a userID and a username to register a bot")
+		return ErrMissingCredentials
 	}
 
 	// Fetch the current username
-	curName, err := c.getUsername(userID)
+	curName, err := c.getUsername(ctx, userID)
 	if err != nil {
 		return err
 	}
 
 	// If username is different than desired name, update it
 	if curName != username {
-		if err := c.setUsername(userID, username); err != nil {
+		if err := c.setUsername(ctx, userID, username); err != nil {
 			return err
 		}
 	}
 
 	c.user.userID = userID
 	c.user.username = username
+	c.state.transitionFrom(StateRegistered, StateConnected)
 	return nil
 }
 
-func (c *Client) getUsername(userID string) (string, error) {
+func (c *Client) getUsername(ctx context.Context, userID string) (string, error) {
 	if userID == "" {
-		return "", fmt.Errorf("Error: Could not fetch Username without a UserID")
+		return "", ErrMissingCredentials
 	}
 
-	c.sendMessage(420, "get_username", userID)
+	data, err := c.EmitWithAck(ctx, "get_username", userID).Wait()
+	if err != nil {
+		return "", fmt.Errorf("Error: Could not fetch Username: %w", err)
+	}
 
-	// Block on waiting for the message dispatch
-	select {
-	case n := <-c.user.usernamec:
-		return n, nil
-	case <-time.After(20 * time.Second):
-		return "", fmt.Errorf("Error: Could not fetch Username. Server never replied with it")
+	var resp getUserNameResp
+	if err := json.Unmarshal(data, &resp); err != nil || len(resp) == 0 {
+		return "", fmt.Errorf("Error: Could not fetch Username. Unexpected reply %v", string(data))
 	}
+	return resp[0], nil
 }
 
 type getUserNameResp []string
 
-func (c *Client) handleGetUsername() {}
-
-type setUserNameResp string
-
-func (c *Client) setUsername(userID string, username string) error {
-	// Send the Username change
-	c.sendMessage(msg, "set_username", c.user.userID, c.user.username)
+// Changes the username. The server replies with error_set_username, whose message is empty if the
+// change succeeded
+func (c *Client) setUsername(ctx context.Context, userID string, username string) error {
+	w := c.expect("error_set_username").failOn(ErrBanned, ErrInvalidUserID)
+	c.sendEvent("set_username", userID, username)
 
-	// Block on waiting for the message dispatch
-	select {
-	case e := <-c.user.usererrc:
-		if e == "" {
-			return nil
-		}
-		return fmt.Errorf("Error: Could not register bot under username %v: %v", username, e)
-	case <-time.After(20 * time.Second):
-		return fmt.Errorf("Error: Could not register bot under new username. Server timeout")
+	evt, err := w.wait(ctx)
+	if err != nil {
+		return fmt.Errorf("Error: Could not register bot under username %v: %w", username, err)
 	}
+	if serr := newServerError(evt.Name, evt.Data); serr.Message != "" {
+		return fmt.Errorf("Error: Could not register bot under username %v: %w", username, serr)
+	}
+	return nil
 }
@@ -2,19 +2,114 @@ package game
 
 // Cell struct is represents the military and terrain state of a cell
 type Cell struct {
-	Armies  int
-	Type    CellType
+	Armies int
+	Type   CellType
+	// Index of the player owning the cell, or Neutral or Unknown. It no longer holds the raw tile
+	// code of the server: mountains are Neutral (not -2) and cells in fog are Unknown (not -3 or -4).
+	// Use Type, Obstacle and Walkable to tell terrain apart
 	Faction int
+	// True if the cell is within sight of our territory this turn
+	Visible bool
 }
 
 // CellType is a generic type for the terrain type of a cell
 type CellType int
 
 const (
-	// Plain indicates an Open Plains cell
-	Plain CellType = iota
+	// Empty indicates an open cell without terrain
+	Empty CellType = iota
 	// City cell
 	City
 	// General cell
 	General
+	// Mountain cell, which can not be entered
+	Mountain
+	// Fog indicates a cell out of sight, which is not an obstacle
+	Fog
+	// FogObstacle indicates a cell out of sight which is a mountain or a city
+	FogObstacle
+	// Swamp cell, which loses an army every turn unless it is empty
+	Swamp
 )
+
+// Plain indicates an Open Plains cell. It is the same as Empty
+const Plain = Empty
+
+func (t CellType) String() string {
+	switch t {
+	case Empty:
+		return "Empty"
+	case City:
+		return "City"
+	case General:
+		return "General"
+	case Mountain:
+		return "Mountain"
+	case Fog:
+		return "Fog"
+	case FogObstacle:
+		return "FogObstacle"
+	case Swamp:
+		return "Swamp"
+	}
+	return "Unknown"
+}
+
+// Faction values of cells which are not owned by a player
+const (
+	// Neutral cells are visible and owned by no player, such as empty cells, mountains and
+	// unclaimed cities
+	Neutral = -1
+	// Unknown cells are out of sight, so their owner can not be seen. It is below every tile code,
+	// so it is never mistaken for one
+	Unknown = -5
+)
+
+// Tile codes the server sends in place of a player index in the terrain half of the map
+const (
+	tileEmpty       = -1
+	tileMountain    = -2
+	tileFog         = -3
+	tileFogObstacle = -4
+)
+
+// Decodes the army count and tile code of a cell sent by the server. Cities, generals and swamps
+// are sent separately, and are applied on top by the caller.
+func decodeCell(armies, tile int) Cell {
+	switch tile {
+	case tileEmpty:
+		return Cell{Armies: armies, Type: Empty, Faction: Neutral, Visible: true}
+	case tileMountain:
+		return Cell{Armies: armies, Type: Mountain, Faction: Neutral, Visible: true}
+	case tileFog:
+		return Cell{Type: Fog, Faction: Unknown}
+	case tileFogObstacle:
+		return Cell{Type: FogObstacle, Faction: Unknown}
+	}
+	return Cell{Armies: armies, Type: Empty, Faction: tile, Visible: true}
+}
+
+// Owned returns true if the cell is owned by a player
+func (c Cell) Owned() bool {
+	return c.Faction >= 0
+}
+
+// Neutral returns true if the cell is visible and owned by no player
+func (c Cell) Neutral() bool {
+	return c.Faction == Neutral
+}
+
+// Known returns true if the owner of the cell can be seen
+func (c Cell) Known() bool {
+	return c.Faction != Unknown
+}
+
+// Obstacle returns true if the cell is, or may be, a mountain. Cities in fog are obstacles too
+func (c Cell) Obstacle() bool {
+	return c.Type == Mountain || c.Type == FogObstacle
+}
+
+// Walkable returns true if armies can move into the cell
+func (c Cell) Walkable() bool {
+	return !c.Obstacle()
+}
@@ -0,0 +1,59 @@
+package game
+
+import "testing"
+
+func TestDecodeCell(t *testing.T) {
+	tests := []struct {
+		name   string
+		armies int
+		tile   int
+		want   Cell
+	}{
+		{"empty", 0, tileEmpty, Cell{Type: Empty, Faction: Neutral, Visible: true}},
+		{"neutral army", 12, tileEmpty, Cell{Armies: 12, Type: Empty, Faction: Neutral, Visible: true}},
+		{"mountain", 0, tileMountain, Cell{Type: Mountain, Faction: Neutral, Visible: true}},
+		{"fog", 0, tileFog, Cell{Type: Fog, Faction: Unknown}},
+		{"fog hides armies", 9, tileFog, Cell{Type: Fog, Faction: Unknown}},
+		{"fog obstacle", 0, tileFogObstacle, Cell{Type: FogObstacle, Faction: Unknown}},
+		{"first player", 3, 0, Cell{Armies: 3, Type: Empty, Faction: 0, Visible: true}},
+		{"other player", 1, 7, Cell{Armies: 1, Type: Empty, Faction: 7, Visible: true}},
+	}
+	for _, tt := range tests {
+		if got := decodeCell(tt.armies, tt.tile); got != tt.want {
+			t.Errorf("%v: decodeCell(%v, %v) = %+v, want %+v", tt.name, tt.armies, tt.tile, got, tt.want)
+		}
+	}
+}
+
+func TestUnknownIsNotATileCode(t *testing.T) {
+	for _, tile := range []int{tileEmpty, tileMountain, tileFog, tileFogObstacle} {
+		if tile == Unknown {
+			t.Errorf("Unknown = %v collides with a tile code", Unknown)
+		}
+	}
+}
+
+func TestCellPredicates(t *testing.T) {
+	tests := []struct {
+		cell                                      Cell
+		owned, neutral, known, obstacle, walkable bool
+	}{
+		{Cell{Type: Empty, Faction: Neutral, Visible: true}, false, true, true, false, true},
+		{Cell{Type: Mountain, Faction: Neutral, Visible: true}, false, true, true, true, false},
+		{Cell{Type: City, Faction: Neutral, Visible: true}, false, true, true, false, true},
+		{Cell{Type: General, Faction: 1, Visible: true}, true, false, true, false, true},
+		{Cell{Type: Swamp, Faction: 0, Visible: true}, true, false, true, false, true},
+		{Cell{Type: Fog, Faction: Unknown}, false, false, false, false, true},
+		{Cell{Type: FogObstacle, Faction: Unknown}, false, false, false, true, false},
+	}
+	for _, tt := range tests {
+		c := tt.cell
+		got := []bool{c.Owned(), c.Neutral(), c.Known(), c.Obstacle(), c.Walkable()}
+		want := []bool{tt.owned, tt.neutral, tt.known, tt.obstacle, tt.walkable}
+		for i, name := range []string{"Owned", "Neutral", "Known", "Obstacle", "Walkable"} {
+			if got[i] != want[i] {
+				t.Errorf("%+v.%v() = %v, want %v", c, name, got[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package game
+
+import "fmt"
+
+// Coord is the position of a cell on the map. X is the column and Y the row, from the top left
+type Coord struct {
+	X, Y int
+}
+
+func (c Coord) String() string {
+	return fmt.Sprintf("(%d,%d)", c.X, c.Y)
+}
+
+// Add returns the coordinate offset by the given amounts
+func (c Coord) Add(dx, dy int) Coord {
+	return Coord{c.X + dx, c.Y + dy}
+}
+
+// Step returns the adjacent coordinate in the given direction
+func (c Coord) Step(d Direction) Coord {
+	dx, dy := d.Delta()
+	return c.Add(dx, dy)
+}
+
+// Distance returns the Manhatten distance between two coordinates
+func (c Coord) Distance(to Coord) int {
+	return abs(c.X-to.X) + abs(c.Y-to.Y)
+}
+
+// Index returns the map index of the coordinate on a map of the given width
+func (c Coord) Index(width int) int {
+	return c.Y*width + c.X
+}
+
+// CoordOf returns the coordinate of a map index on a map of the given width
+func CoordOf(index, width int) Coord {
+	return Coord{index % width, index / width}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Direction is one of the four directions armies can move in
+type Direction int
+
+const (
+	// Up moves to the previous row
+	Up Direction = iota
+	// Down moves to the next row
+	Down
+	// Left moves to the previous column
+	Left
+	// Right moves to the next column
+	Right
+)
+
+// Directions lists every direction, in the order GetAdjacents returns neighbours
+var Directions = []Direction{Up, Down, Left, Right}
+
+// Delta returns the change in X and Y of a step in the direction
+func (d Direction) Delta() (dx, dy int) {
+	switch d {
+	case Up:
+		return 0, -1
+	case Down:
+		return 0, 1
+	case Left:
+		return -1, 0
+	case Right:
+		return 1, 0
+	}
+	return 0, 0
+}
+
+// Opposite returns the direction pointing the other way
+func (d Direction) Opposite() Direction {
+	switch d {
+	case Up:
+		return Down
+	case Down:
+		return Up
+	case Left:
+		return Right
+	}
+	return Left
+}
+
+func (d Direction) String() string {
+	switch d {
+	case Up:
+		return "Up"
+	case Down:
+		return "Down"
+	case Left:
+		return "Left"
+	case Right:
+		return "Right"
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+// Coord returns the coordinate of a map index
+func (g *Game) Coord(index int) Coord {
+	return CoordOf(index, g.Width)
+}
+
+// Index returns the map index of a coordinate
+func (g *Game) Index(c Coord) int {
+	return c.Index(g.Width)
+}
+
+// InBounds returns true if the coordinate is on the map
+func (g *Game) InBounds(c Coord) bool {
+	return c.X >= 0 && c.X < g.Width && c.Y >= 0 && c.Y < g.Height
+}
+
+// CellAt returns the cell at a coordinate, which must be on the map
+func (g *Game) CellAt(c Coord) Cell {
+	return g.GameMap[g.Index(c)]
+}
+
+// Coords returns the coordinate of every cell, row by row
+func (g *Game) Coords() []Coord {
+	return g.Rect(Coord{0, 0}, Coord{g.Width - 1, g.Height - 1})
+}
+
+// Row returns the coordinates of the cells in a row, from left to right
+func (g *Game) Row(y int) []Coord {
+	return g.Rect(Coord{0, y}, Coord{g.Width - 1, y})
+}
+
+// Column returns the coordinates of the cells in a column, from top to bottom
+func (g *Game) Column(x int) []Coord {
+	return g.Rect(Coord{x, 0}, Coord{x, g.Height - 1})
+}
+
+// Rect returns the coordinates of the cells in the rectangle between two corners, inclusive, row by
+// row. Parts of the rectangle off the map are left out.
+func (g *Game) Rect(from, to Coord) (coords []Coord) {
+	if from.X > to.X {
+		from.X, to.X = to.X, from.X
+	}
+	if from.Y > to.Y {
+		from.Y, to.Y = to.Y, from.Y
+	}
+	for y := from.Y; y <= to.Y; y++ {
+		for x := from.X; x <= to.X; x++ {
+			if c := (Coord{x, y}); g.InBounds(c) {
+				coords = append(coords, c)
+			}
+		}
+	}
+	return
+}
+
+// Ring returns the coordinates of the cells at exactly the given Manhatten distance from the
+// center, clockwise from the top. Parts of the ring off the map are left out. No cell is at a
+// negative distance, so a negative radius returns no cells.
+func (g *Game) Ring(center Coord, radius int) (coords []Coord) {
+	if radius < 0 {
+		return nil
+	}
+	if radius == 0 {
+		if g.InBounds(center) {
+			coords = append(coords, center)
+		}
+		return
+	}
+	// Walk the four edges of the diamond, starting from its top corner
+	c := center.Add(0, -radius)
+	for _, step := range [][2]int{{1, 1}, {-1, 1}, {-1, -1}, {1, -1}} {
+		for i := 0; i < radius; i++ {
+			if g.InBounds(c) {
+				coords = append(coords, c)
+			}
+			c = c.Add(step[0], step[1])
+		}
+	}
+	return
+}
+
+// GetAdjacentsAt returns the coordinates of the cells adjacent to a coordinate
+func (g *Game) GetAdjacentsAt(from Coord) (adjacent []Coord) {
+	for _, d := range Directions {
+		if c := from.Step(d); g.InBounds(c) {
+			adjacent = append(adjacent, c)
+		}
+	}
+	return
+}
+
+// GetNeighborhoodAt returns the coordinates of the up to 8 cells surrounding a coordinate
+func (g *Game) GetNeighborhoodAt(from Coord) (neighborhood []Coord) {
+	for _, c := range g.Rect(from.Add(-1, -1), from.Add(1, 1)) {
+		if c != from {
+			neighborhood = append(neighborhood, c)
+		}
+	}
+	return
+}
+
+// GetDistanceAt returns the Manhatten distance between two coordinates
+func (g *Game) GetDistanceAt(from, to Coord) int {
+	return from.Distance(to)
+}
+
+// WalkableAt is true if the coordinate is on the map and not a mountain or fog obstacle
+func (g *Game) WalkableAt(c Coord) bool {
+	return g.InBounds(c) && g.CellAt(c).Walkable()
+}
@@ -0,0 +1,158 @@
+package game
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Returns a game with an empty map of the given size
+func newTestMap(width, height int) *Game {
+	g := &Game{Width: width, Height: height, GameMap: make([]Cell, width*height)}
+	for i := range g.GameMap {
+		g.GameMap[i] = Cell{Type: Empty, Faction: Neutral, Visible: true}
+	}
+	return g
+}
+
+func TestCoordIndex(t *testing.T) {
+	g := newTestMap(5, 3)
+	for i := 0; i < 15; i++ {
+		c := g.Coord(i)
+		if c != CoordOf(i, 5) || g.Index(c) != i || !g.InBounds(c) {
+			t.Errorf("Coord(%v) = %v, Index = %v", i, c, g.Index(c))
+		}
+	}
+	if c := g.Coord(7); c != (Coord{2, 1}) {
+		t.Errorf("Coord(7) = %v, want (2,1)", c)
+	}
+	for _, c := range []Coord{{-1, 0}, {0, -1}, {5, 0}, {0, 3}} {
+		if g.InBounds(c) {
+			t.Errorf("InBounds(%v) = true", c)
+		}
+	}
+}
+
+func TestDirections(t *testing.T) {
+	for _, d := range Directions {
+		c := Coord{3, 3}
+		if back := c.Step(d).Step(d.Opposite()); back != c {
+			t.Errorf("stepping %v and back from %v ends at %v", d, c, back)
+		}
+		if c.Distance(c.Step(d)) != 1 {
+			t.Errorf("step %v is not adjacent", d)
+		}
+	}
+}
+
+func TestRect(t *testing.T) {
+	g := newTestMap(4, 3)
+	tests := []struct {
+		from, to Coord
+		want     []Coord
+	}{
+		{Coord{1, 0}, Coord{2, 1}, []Coord{{1, 0}, {2, 0}, {1, 1}, {2, 1}}},
+		// Corners in any order
+		{Coord{2, 1}, Coord{1, 0}, []Coord{{1, 0}, {2, 0}, {1, 1}, {2, 1}}},
+		// Clipped at the edges
+		{Coord{-1, -1}, Coord{0, 1}, []Coord{{0, 0}, {0, 1}}},
+		{Coord{3, 2}, Coord{5, 5}, []Coord{{3, 2}}},
+		{Coord{5, 5}, Coord{6, 6}, nil},
+	}
+	for _, tt := range tests {
+		if got := g.Rect(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Rect(%v, %v) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+	if got := g.Row(1); !reflect.DeepEqual(got, []Coord{{0, 1}, {1, 1}, {2, 1}, {3, 1}}) {
+		t.Errorf("Row(1) = %v", got)
+	}
+	if got := g.Column(3); !reflect.DeepEqual(got, []Coord{{3, 0}, {3, 1}, {3, 2}}) {
+		t.Errorf("Column(3) = %v", got)
+	}
+	if got := g.Coords(); len(got) != 12 || got[5] != (Coord{1, 1}) {
+		t.Errorf("Coords() = %v", got)
+	}
+}
+
+func TestRing(t *testing.T) {
+	g := newTestMap(7, 7)
+	center := Coord{3, 3}
+	tests := []struct {
+		center Coord
+		radius int
+		want   []Coord
+	}{
+		{center, -1, nil},
+		{center, 0, []Coord{{3, 3}}},
+		// Clockwise from the top
+		{center, 1, []Coord{{3, 2}, {4, 3}, {3, 4}, {2, 3}}},
+		{center, 2, []Coord{{3, 1}, {4, 2}, {5, 3}, {4, 4}, {3, 5}, {2, 4}, {1, 3}, {2, 2}}},
+		// Clipped at the edges
+		{Coord{0, 0}, 1, []Coord{{1, 0}, {0, 1}}},
+		{Coord{0, 0}, 2, []Coord{{2, 0}, {1, 1}, {0, 2}}},
+		{Coord{6, 3}, 1, []Coord{{6, 2}, {6, 4}, {5, 3}}},
+		{Coord{-1, 0}, 0, nil},
+	}
+	for _, tt := range tests {
+		if got := g.Ring(tt.center, tt.radius); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Ring(%v, %v) = %v, want %v", tt.center, tt.radius, got, tt.want)
+		}
+	}
+
+	// Every cell of a large ring is at the radius
+	for _, c := range g.Ring(center, 3) {
+		if d := c.Distance(center); d != 3 {
+			t.Errorf("Ring(%v, 3) contains %v at distance %v", center, c, d)
+		}
+	}
+}
+
+func TestCoordHelpersMatchIndexHelpers(t *testing.T) {
+	for _, size := range [][2]int{{1, 1}, {1, 4}, {4, 1}, {3, 3}, {5, 4}} {
+		g := newTestMap(size[0], size[1])
+		for i := range g.GameMap {
+			c := g.Coord(i)
+
+			adjacent := []int{}
+			for _, a := range g.GetAdjacentsAt(c) {
+				adjacent = append(adjacent, g.Index(a))
+			}
+			if want := g.GetAdjacents(i); len(want) != len(adjacent) || (len(want) > 0 && !reflect.DeepEqual(adjacent, want)) {
+				t.Errorf("%vx%v: GetAdjacentsAt(%v) = %v, GetAdjacents(%v) = %v", size[0], size[1], c, adjacent, i, want)
+			}
+
+			// GetNeighborhood lists the cells in a different order
+			neighborhood := []int{}
+			for _, n := range g.GetNeighborhoodAt(c) {
+				neighborhood = append(neighborhood, g.Index(n))
+			}
+			want := append([]int{}, g.GetNeighborhood(i)...)
+			sort.Ints(neighborhood)
+			sort.Ints(want)
+			if len(want) != len(neighborhood) || (len(want) > 0 && !reflect.DeepEqual(neighborhood, want)) {
+				t.Errorf("%vx%v: GetNeighborhoodAt(%v) = %v, GetNeighborhood(%v) = %v", size[0], size[1], c, neighborhood, i, want)
+			}
+
+			for j := range g.GameMap {
+				if g.GetDistanceAt(c, g.Coord(j)) != g.GetDistance(i, j) {
+					t.Errorf("GetDistanceAt(%v, %v) != GetDistance(%v, %v)", c, g.Coord(j), i, j)
+				}
+			}
+		}
+	}
+}
+
+func TestWalkableAt(t *testing.T) {
+	g := newTestMap(3, 1)
+	g.GameMap[1].Type = Mountain
+	g.GameMap[2] = Cell{Type: FogObstacle, Faction: Unknown}
+	for _, tt := range []struct {
+		c    Coord
+		want bool
+	}{{Coord{0, 0}, true}, {Coord{1, 0}, false}, {Coord{2, 0}, false}, {Coord{-1, 0}, false}, {Coord{3, 0}, false}} {
+		if got := g.WalkableAt(tt.c); got != tt.want {
+			t.Errorf("WalkableAt(%v) = %v, want %v", tt.c, got, tt.want)
+		}
+	}
+}
@@ -6,10 +6,21 @@ package game
 
 import (
 	"encoding/json"
+	"sync"
+
+	"github.com/brisberg/generals-io-bot/logger"
 )
 
 // Game is a struct containing all of the gamestate of a Generals.io game session.
+//
+// The client applies events to the Game on its own goroutine. Code running on another goroutine,
+// such as a strategy, must read the state through Snapshot, which returns a copy consistent with
+// a single update. The event methods, Snapshot, ReplayID, QueueLength and NextAttackIndex take the
+// Game's lock and are safe to call from any goroutine; the fields and the other methods are not.
 type Game struct {
+	// Guards the state against concurrent events and snapshots
+	mu sync.Mutex
+
 	// c  *client.Client
 	ID string
 
@@ -23,6 +34,13 @@ type Game struct {
 	Lost     func()
 	Chat     func(user int, message string)
 
+	// Logger for the game. Nil uses the default logger of the logger package
+	Logger logger.Logger
+
+	// Minimum distance between generals assumed when inferring where enemy generals are.
+	// Zero uses DefaultMinGeneralDistance
+	MinGeneralDistance int
+
 	lastAttack  int
 	attackIndex int
 
@@ -30,11 +48,17 @@ type Game struct {
 	Width       int
 	Height      int
 	GameMap     []Cell
-	inited      bool
-	TurnCount   int
+	// Last observed state of every cell of GameMap
+	Memory []Memory
+	inited bool
+	// Number of updates since the game started. Updates are half-turns, see Turn
+	TurnCount int
 
 	mapRaw    []int
 	citiesRaw []int
+	swamps    []int
+	teams     []int
+	inference inference
 
 	Scores []struct {
 		Armies int  `json:"total"`
@@ -69,12 +93,21 @@ func (g *Game) GameStart(raw json.RawMessage) {
 		ReplayID    string   `json:"replay_id"`
 		ChatRoom    string   `json:"chat_room"`
 		Usernames   []string `json:"usernames"`
+		Swamps      []int    `json:"swamps"`
+		Teams       []int    `json:"teams"`
 	}{}
 	decode := []interface{}{nil, &gameinfo}
-	json.Unmarshal(raw, &decode)
+	g.mu.Lock()
+	if err := json.Unmarshal(raw, &decode); err != nil {
+		g.log().Warn("Error decoding game start", "err", err)
+	}
 	g.PlayerIndex = gameinfo.PlayerIndex
 	g.chatroom = gameinfo.ChatRoom
 	g.replayID = gameinfo.ReplayID
+	g.swamps = gameinfo.Swamps
+	g.teams = gameinfo.Teams
+	g.log().Info("Game started", "player", gameinfo.PlayerIndex, "usernames", gameinfo.Usernames)
+	g.mu.Unlock()
 	if g.Start != nil {
 		g.Start(gameinfo.PlayerIndex, gameinfo.Usernames)
 	}
@@ -84,8 +117,23 @@ func (g *Game) GameStart(raw json.RawMessage) {
 func (g *Game) GameUpdate(raw json.RawMessage) {
 	update := gameUpdate{}
 	decode := []interface{}{nil, &update}
-	json.Unmarshal(raw, &decode)
+	if err := json.Unmarshal(raw, &decode); err != nil {
+		g.mu.Lock()
+		g.log().Warn("Error decoding game update", "err", err)
+		g.mu.Unlock()
+		return
+	}
 
+	g.mu.Lock()
+	g.applyUpdate(update)
+	g.mu.Unlock()
+	if g.Update != nil {
+		g.Update(update)
+	}
+}
+
+// Applies an update to the map and the models built on it. Must be called with the lock held
+func (g *Game) applyUpdate(update gameUpdate) {
 	newRaw := []int{}
 	difPos := 0
 	oldPos := 0
@@ -137,56 +185,149 @@ func (g *Game) GameUpdate(raw json.RawMessage) {
 		g.Width = g.mapRaw[0]
 		g.Height = g.mapRaw[1]
 		g.GameMap = make([]Cell, g.Width*g.Height)
+		g.Memory = newMemory(g.Width * g.Height)
 		g.inited = true
 	}
 
 	g.TurnCount = update.Turn
 	g.attackIndex = update.AttackIndex
+	g.log().Debug("Game update", "attackIndex", update.AttackIndex)
 
 	g.Scores = update.Scores
 
-	for x := 0; x < g.Width; x++ {
-		for y := 0; y < g.Height; y++ {
-			g.GameMap[y*g.Width+x].Armies = g.mapRaw[y*g.Width+x+2]
-		}
+	size := g.Width * g.Height
+	previous := append([]Cell{}, g.GameMap...)
+	for i := range g.GameMap {
+		g.GameMap[i] = decodeCell(g.mapRaw[i+2], g.mapRaw[i+2+size])
 	}
-	for x := 0; x < g.Width; x++ {
-		for y := 0; y < g.Height; y++ {
-			g.GameMap[y*g.Width+x].Faction = g.mapRaw[y*g.Width+x+2+g.Width*g.Height]
+	// Swamps are known from the start, cities and generals for as long as the server lists them
+	for _, swamp := range g.swamps {
+		if swamp >= 0 && swamp < size && g.GameMap[swamp].Type != FogObstacle {
+			g.GameMap[swamp].Type = Swamp
 		}
 	}
 	for _, city := range g.citiesRaw {
-		if city >= 0 {
+		if city >= 0 && city < size {
 			g.GameMap[city].Type = City
 		}
 	}
 	for _, general := range update.Generals {
-		if general >= 0 {
+		if general >= 0 && general < size {
 			g.GameMap[general].Type = General
 		}
 	}
+	for i, cell := range g.GameMap {
+		g.Memory[i].observe(cell, g.TurnCount)
+	}
+	g.inferGenerals(previous, update.Generals)
+}
 
-	if g.Update != nil {
-		g.Update(update)
+// ReplayID returns the ID of the replay of the game, which the replay package can fetch
+func (g *Game) ReplayID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.replayID
+}
+
+// Snapshot returns a copy of the game state as of the last update, which is safe to read while
+// the client keeps updating the game. The copy has no callbacks.
+func (g *Game) Snapshot() *Game {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := &Game{
+		ID:                 g.ID,
+		chatroom:           g.chatroom,
+		replayID:           g.replayID,
+		Logger:             g.Logger,
+		MinGeneralDistance: g.MinGeneralDistance,
+		lastAttack:         g.lastAttack,
+		attackIndex:        g.attackIndex,
+		PlayerIndex:        g.PlayerIndex,
+		Width:              g.Width,
+		Height:             g.Height,
+		GameMap:            append([]Cell(nil), g.GameMap...),
+		Memory:             append([]Memory(nil), g.Memory...),
+		inited:             g.inited,
+		TurnCount:          g.TurnCount,
+		mapRaw:             g.mapRaw,
+		citiesRaw:          g.citiesRaw,
+		swamps:             g.swamps,
+		teams:              g.teams,
+		inference:          g.inference.copy(),
 	}
+	s.Scores = append(s.Scores, g.Scores...)
+	return s
 }
 
-// GameWon empty
-func (g *Game) GameWon() {}
+// Resync discards the raw map state after the client reconnected.
+// The server sends the full map again in the next update, diffed against an empty map.
+func (g *Game) Resync() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.mapRaw = nil
+	g.citiesRaw = nil
+}
+
+// ChatMessage process a chat message received during the game
+func (g *Game) ChatMessage(raw json.RawMessage) {
+	message := struct {
+		Text        string `json:"text"`
+		PlayerIndex *int   `json:"playerIndex"`
+	}{}
+	decode := []interface{}{nil, nil, &message}
+	json.Unmarshal(raw, &decode)
 
-// GameLost empty
-func (g *Game) GameLost() {}
+	user := -1
+	if message.PlayerIndex != nil {
+		user = *message.PlayerIndex
+	}
+	if g.Chat != nil {
+		g.Chat(user, message.Text)
+	}
+}
+
+// GameWon logs the win
+func (g *Game) GameWon() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.log().Info("Game won")
+}
+
+// GameLost logs the loss
+func (g *Game) GameLost() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.log().Info("Game lost")
+}
+
+// Returns the logger with the fields identifying the game and turn
+func (g *Game) log() logger.Logger {
+	return logger.Or(g.Logger).With("replay", g.replayID, "turn", g.TurnCount)
+}
 
 // GameOver empty
 func (g *Game) GameOver() {}
 
-// Dispatch handles any game events
+// Dispatch handles any game events forwarded by the client, by name
 func (g *Game) Dispatch(event string, data json.RawMessage) {
 	switch event {
+	case "pre_game_start":
+		g.PreGameStart()
 	case "game_start":
-
+		g.GameStart(data)
 	case "game_update":
-
+		g.GameUpdate(data)
+	case "resync": // client.EventResync
+		g.Resync()
+	case "chat_message":
+		g.ChatMessage(data)
+	case "game_won":
+		g.GameWon()
+	case "game_lost":
+		g.GameLost()
+	case "game_over":
+		g.GameOver()
 	}
 }
 
@@ -252,23 +393,23 @@ func (g *Game) GetDistance(from, to int) int {
 	return dx + dy
 }
 
-// SendChat sends a message to the current chatroom
-// func (g *Game) SendChat(msg string) {
-// 	g.c.sendMessage("chat_message", g.chatroom, msg)
-// }
-
 // QueueLength is how many attacks we have queued up
 func (g *Game) QueueLength() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	return g.lastAttack - g.attackIndex
 }
 
 // Walkable is true if the given cell is not a mountain or fog obstacle
 func (g *Game) Walkable(cell int) bool {
-	return g.GameMap[cell].Faction != -2 && g.GameMap[cell].Faction != -4
+	return g.GameMap[cell].Walkable()
 }
 
-// NextAttackIndex temp function meant to simulate the old behavior of attack indexes
+// NextAttackIndex temp function meant to simulate the old behavior of attack indexes.
+// Call it on the Game the client updates, not on a snapshot, so that indexes are not reused.
 func (g *Game) NextAttackIndex() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	g.lastAttack++
 	return g.lastAttack
 }
@@ -0,0 +1,130 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/brisberg/generals-io-bot/logger"
+)
+
+// Map state sent to a test game in a single update
+type testUpdate struct {
+	turn int
+	// Army count and tile code of every cell, in row-major order
+	armies  []int
+	terrain []int
+	cities  []int
+	// Index of each player's general, or -1 if unknown
+	generals []int
+}
+
+// Starts a game on a width x height map, as the given player
+func startTestGame(t *testing.T, playerIndex int, swamps, teams []int) *Game {
+	t.Helper()
+	g := &Game{Logger: logger.Nop()}
+	start := map[string]interface{}{
+		"playerIndex": playerIndex,
+		"replay_id":   "test",
+		"usernames":   []string{"a", "b", "c", "d"},
+		"swamps":      swamps,
+		"teams":       teams,
+	}
+	g.GameStart(mustMarshal(t, []interface{}{"game_start", start}))
+	return g
+}
+
+// Sends an update to the game which replaces the whole map
+func sendTestUpdate(t *testing.T, g *Game, width, height int, u testUpdate) {
+	t.Helper()
+	if len(u.armies) != width*height || len(u.terrain) != width*height {
+		t.Fatalf("update has %v armies and %v tiles, want %v", len(u.armies), len(u.terrain), width*height)
+	}
+	mapRaw := append([]int{width, height}, u.armies...)
+	mapRaw = append(mapRaw, u.terrain...)
+	generals := u.generals
+	if generals == nil {
+		generals = []int{}
+	}
+	update := map[string]interface{}{
+		"turn":        u.turn,
+		"map_diff":    append([]int{0, len(mapRaw)}, mapRaw...),
+		"cities_diff": append([]int{0, len(u.cities)}, u.cities...),
+		"generals":    generals,
+		"scores":      []interface{}{},
+	}
+	g.GameUpdate(mustMarshal(t, []interface{}{"game_update", update}))
+}
+
+func mustMarshal(t *testing.T, v interface{}) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Returns a slice of n copies of v
+func repeat(v, n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = v
+	}
+	return s
+}
+
+func TestGameUpdateOverlays(t *testing.T) {
+	g := startTestGame(t, 0, []int{2, 4}, nil)
+	// 3x2 map:
+	//   general(0)  city(neutral)  swamp
+	//   fog         swamp in fog   fog obstacle
+	sendTestUpdate(t, g, 3, 2, testUpdate{
+		turn:     1,
+		armies:   []int{5, 40, 0, 0, 0, 0},
+		terrain:  []int{0, tileEmpty, tileEmpty, tileFog, tileFog, tileFogObstacle},
+		cities:   []int{1},
+		generals: []int{0, -1},
+	})
+
+	want := []Cell{
+		{Armies: 5, Type: General, Faction: 0, Visible: true},
+		{Armies: 40, Type: City, Faction: Neutral, Visible: true},
+		{Armies: 0, Type: Swamp, Faction: Neutral, Visible: true},
+		{Type: Fog, Faction: Unknown},
+		{Type: Swamp, Faction: Unknown},
+		{Type: FogObstacle, Faction: Unknown},
+	}
+	for i, w := range want {
+		if g.GameMap[i] != w {
+			t.Errorf("cell %v = %+v, want %+v", i, g.GameMap[i], w)
+		}
+	}
+
+	// A general or city which is no longer listed reverts to its tile
+	sendTestUpdate(t, g, 3, 2, testUpdate{
+		turn:     2,
+		armies:   []int{6, 40, 0, 0, 0, 0},
+		terrain:  []int{0, tileEmpty, tileEmpty, tileFog, tileFog, tileFogObstacle},
+		generals: []int{-1, -1},
+	})
+	if c := g.GameMap[0]; c.Type != Empty || c.Faction != 0 || c.Armies != 6 {
+		t.Errorf("unlisted general = %+v, want an owned empty cell", c)
+	}
+	if c := g.GameMap[1]; c.Type != Empty {
+		t.Errorf("unlisted city = %+v, want an empty cell", c)
+	}
+}
+
+func TestSnapshotIsIndependent(t *testing.T) {
+	g := startTestGame(t, 0, nil, nil)
+	sendTestUpdate(t, g, 2, 1, testUpdate{turn: 1, armies: []int{1, 0}, terrain: []int{0, tileEmpty}, generals: []int{0, -1}})
+
+	s := g.Snapshot()
+	sendTestUpdate(t, g, 2, 1, testUpdate{turn: 2, armies: []int{2, 1}, terrain: []int{0, 0}, generals: []int{0, -1}})
+	if s.TurnCount != 1 || s.GameMap[1].Faction != Neutral || s.Remembered(1).Faction != Neutral {
+		t.Errorf("snapshot changed with the game: turn %v, cell %+v", s.TurnCount, s.GameMap[1])
+	}
+	if g.GameMap[1].Faction != 0 {
+		t.Errorf("game cell = %+v, want it owned after the update", g.GameMap[1])
+	}
+}
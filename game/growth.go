@@ -0,0 +1,67 @@
+package game
+
+const (
+	// TicksPerTurn is the number of server updates in a turn. TurnCount counts updates, so it
+	// advances twice per turn. Each player may move once per update.
+	TicksPerTurn = 2
+	// BonusInterval is the number of turns between the bonuses which grow every owned cell
+	BonusInterval = 25
+)
+
+// Turn returns the turn of the game, as shown by the Generals.io client. It is half of TurnCount
+func (g *Game) Turn() int {
+	return g.TurnCount / TicksPerTurn
+}
+
+// UpdatesUntilGrowth returns the number of updates until generals and cities next grow
+func (g *Game) UpdatesUntilGrowth() int {
+	return TicksPerTurn - g.TurnCount%TicksPerTurn
+}
+
+// TurnsUntilBonus returns the number of turns until every owned cell next grows
+func (g *Game) TurnsUntilBonus() int {
+	return BonusInterval - g.Turn()%BonusInterval
+}
+
+// Predict returns the map as it will be in the given number of turns if nobody moves.
+// Cells in fog are projected from their memory, starting from the turn they were last seen.
+//
+// Generals and owned cities grow by one every turn, every owned cell grows by one every
+// BonusInterval turns, and owned swamps lose one army every turn until they are neutral again.
+func (g *Game) Predict(turns int) []Cell {
+	until := g.TurnCount + turns*TicksPerTurn
+	predicted := make([]Cell, len(g.GameMap))
+	for i, c := range g.GameMap {
+		from := g.TurnCount
+		if !c.Visible && i < len(g.Memory) && g.Memory[i].Seen {
+			m := g.Memory[i]
+			c = Cell{Armies: m.Armies, Type: m.Type, Faction: m.Faction}
+			from = m.Turn
+		}
+		predicted[i] = grow(c, from, until)
+	}
+	return predicted
+}
+
+// Returns the cell grown from one TurnCount to a later one
+func grow(c Cell, from, until int) Cell {
+	if !c.Owned() || until <= from {
+		return c
+	}
+	turns := until/TicksPerTurn - from/TicksPerTurn
+	bonuses := until/(TicksPerTurn*BonusInterval) - from/(TicksPerTurn*BonusInterval)
+
+	switch c.Type {
+	case General, City:
+		c.Armies += turns + bonuses
+	case Swamp:
+		c.Armies -= turns
+		if c.Armies <= 0 {
+			c.Armies = 0
+			c.Faction = Neutral
+		}
+	default:
+		c.Armies += bonuses
+	}
+	return c
+}
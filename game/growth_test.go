@@ -0,0 +1,109 @@
+package game
+
+import "testing"
+
+func TestGrow(t *testing.T) {
+	general := Cell{Armies: 10, Type: General, Faction: 0, Visible: true}
+	city := Cell{Armies: 10, Type: City, Faction: 1, Visible: true}
+	neutralCity := Cell{Armies: 40, Type: City, Faction: Neutral, Visible: true}
+	plain := Cell{Armies: 10, Type: Empty, Faction: 0, Visible: true}
+	swamp := Cell{Armies: 3, Type: Swamp, Faction: 0, Visible: true}
+
+	tests := []struct {
+		name        string
+		cell        Cell
+		from, until int
+		armies      int
+		faction     int
+	}{
+		{"general over a turn", general, 10, 12, 11, 0},
+		{"general over a half turn ending a turn", general, 11, 12, 11, 0},
+		{"general over a half turn within a turn", general, 10, 11, 10, 0},
+		{"general over many turns", general, 10, 30, 20, 0},
+		{"general across a bonus", general, 48, 50, 12, 0},
+		{"city over 50 turns", city, 0, 100, 62, 1},
+		{"neutral city", neutralCity, 0, 100, 40, Neutral},
+		{"plain before a bonus", plain, 0, 49, 10, 0},
+		{"plain reaching a bonus", plain, 49, 50, 11, 0},
+		{"plain across a bonus", plain, 48, 52, 11, 0},
+		{"plain after a bonus", plain, 50, 99, 10, 0},
+		{"plain across two bonuses", plain, 40, 110, 12, 0},
+		{"swamp decays", swamp, 10, 14, 1, 0},
+		{"swamp decays to neutral", swamp, 10, 16, 0, Neutral},
+		{"swamp does not go negative", swamp, 10, 40, 0, Neutral},
+		{"no time passes", general, 12, 12, 10, 0},
+		{"going back in time", general, 12, 8, 10, 0},
+	}
+	for _, tt := range tests {
+		got := grow(tt.cell, tt.from, tt.until)
+		if got.Armies != tt.armies || got.Faction != tt.faction || got.Type != tt.cell.Type {
+			t.Errorf("%v: grow(%+v, %v, %v) = %+v, want %v armies of faction %v",
+				tt.name, tt.cell, tt.from, tt.until, got, tt.armies, tt.faction)
+		}
+	}
+}
+
+func TestTurnCounters(t *testing.T) {
+	tests := []struct {
+		turnCount, turn, updatesUntilGrowth, turnsUntilBonus int
+	}{
+		{0, 0, 2, 25},
+		{1, 0, 1, 25},
+		{2, 1, 2, 24},
+		{48, 24, 2, 1},
+		{49, 24, 1, 1},
+		{50, 25, 2, 25},
+		{51, 25, 1, 25},
+	}
+	for _, tt := range tests {
+		g := &Game{TurnCount: tt.turnCount}
+		if got := g.Turn(); got != tt.turn {
+			t.Errorf("TurnCount %v: Turn() = %v, want %v", tt.turnCount, got, tt.turn)
+		}
+		if got := g.UpdatesUntilGrowth(); got != tt.updatesUntilGrowth {
+			t.Errorf("TurnCount %v: UpdatesUntilGrowth() = %v, want %v", tt.turnCount, got, tt.updatesUntilGrowth)
+		}
+		if got := g.TurnsUntilBonus(); got != tt.turnsUntilBonus {
+			t.Errorf("TurnCount %v: TurnsUntilBonus() = %v, want %v", tt.turnCount, got, tt.turnsUntilBonus)
+		}
+	}
+}
+
+func TestPredict(t *testing.T) {
+	g := startTestGame(t, 0, nil, nil)
+	// Our general at 0, an enemy city at 1 and an unexplored cell at 2
+	sendTestUpdate(t, g, 3, 1, testUpdate{
+		turn:     10,
+		armies:   []int{4, 5, 0},
+		terrain:  []int{0, 1, tileFog},
+		cities:   []int{1},
+		generals: []int{0, -1},
+	})
+	// The city goes out of sight
+	sendTestUpdate(t, g, 3, 1, testUpdate{
+		turn:     21,
+		armies:   []int{9, 0, 0},
+		terrain:  []int{0, tileFogObstacle, tileFog},
+		generals: []int{0, -1},
+	})
+
+	predicted := g.Predict(2)
+	// 21 -> 25 crosses two turns
+	if c := predicted[0]; c.Armies != 11 || c.Type != General || c.Faction != 0 {
+		t.Errorf("predicted general = %+v, want 11 armies", c)
+	}
+	// Projected from its memory on update 10: 10 -> 25 crosses seven turns
+	if c := predicted[1]; c.Armies != 12 || c.Type != City || c.Faction != 1 {
+		t.Errorf("predicted remembered city = %+v, want 12 armies of player 1", c)
+	}
+	if c := predicted[2]; c != g.GameMap[2] {
+		t.Errorf("predicted unexplored cell = %+v, want it unchanged", c)
+	}
+	if c := g.Predict(0)[1]; c.Armies != 10 {
+		t.Errorf("remembered city now = %+v, want 10 armies", c)
+	}
+	// The game itself is not changed
+	if g.GameMap[0].Armies != 9 {
+		t.Errorf("Predict changed the map: %+v", g.GameMap[0])
+	}
+}
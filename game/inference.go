@@ -0,0 +1,221 @@
+package game
+
+import "sort"
+
+// DefaultMinGeneralDistance is the distance the server is assumed to keep between generals when
+// placing them, if Game.MinGeneralDistance is not set
+const DefaultMinGeneralDistance = 9
+
+// Number of army sightings kept per player as evidence of where their general is
+const maxSightings = 64
+
+// Candidate is a cell which may hold the general of an enemy
+type Candidate struct {
+	Cell   int
+	Player int
+	// Probability that the general is on the cell, between 0 and 1
+	Likelihood float64
+}
+
+// An enemy army seen coming out of the fog, which likely came from the direction of their general
+type sighting struct {
+	cell   int
+	armies int
+}
+
+// Likelihood grids of the general of every enemy, recomputed every update
+type inference struct {
+	grids     map[int][]float64
+	sightings map[int][]sighting
+}
+
+// Returns a deep copy of the grids and sightings
+func (in inference) copy() inference {
+	c := inference{
+		grids:     make(map[int][]float64, len(in.grids)),
+		sightings: make(map[int][]sighting, len(in.sightings)),
+	}
+	for player, grid := range in.grids {
+		c.grids[player] = append([]float64(nil), grid...)
+	}
+	for player, sightings := range in.sightings {
+		c.sightings[player] = append([]sighting(nil), sightings...)
+	}
+	return c
+}
+
+// GeneralLikelihood returns the probability of the player's general being on each cell of the
+// map. It returns nil if the player is not an enemy which is still playing.
+func (g *Game) GeneralLikelihood(player int) []float64 {
+	grid := g.inference.grids[player]
+	if grid == nil {
+		return nil
+	}
+	return append([]float64{}, grid...)
+}
+
+// GeneralCandidates returns up to n of the most likely cells for the player's general, most likely
+// first. A general which has been seen is the only candidate, with a likelihood of 1.
+func (g *Game) GeneralCandidates(player, n int) []Candidate {
+	candidates := []Candidate{}
+	for cell, likelihood := range g.inference.grids[player] {
+		if likelihood > 0 {
+			candidates = append(candidates, Candidate{cell, player, likelihood})
+		}
+	}
+	return topCandidates(candidates, n)
+}
+
+// LikelyGenerals returns up to n of the most likely cells for the general of any enemy
+func (g *Game) LikelyGenerals(n int) []Candidate {
+	candidates := []Candidate{}
+	for player := range g.inference.grids {
+		candidates = append(candidates, g.GeneralCandidates(player, n)...)
+	}
+	return topCandidates(candidates, n)
+}
+
+// Sorts the candidates by likelihood and keeps the first n
+func topCandidates(candidates []Candidate, n int) []Candidate {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Likelihood != candidates[j].Likelihood {
+			return candidates[i].Likelihood > candidates[j].Likelihood
+		}
+		return candidates[i].Cell < candidates[j].Cell
+	})
+	if n >= 0 && len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// Recomputes the likelihood grids from the generals revealed by the server, the memory of the map
+// and the enemy armies which came into sight since the previous update
+func (g *Game) inferGenerals(previous []Cell, generals []int) {
+	if g.inference.sightings == nil {
+		g.inference.sightings = make(map[int][]sighting)
+	}
+	g.inference.grids = make(map[int][]float64)
+
+	ours := -1
+	if g.PlayerIndex < len(generals) {
+		ours = generals[g.PlayerIndex]
+	}
+	for player, general := range generals {
+		if !g.IsEnemy(player) || g.isDead(player) {
+			continue
+		}
+		grid := make([]float64, len(g.GameMap))
+		if general >= 0 && general < len(grid) {
+			grid[general] = 1
+		} else {
+			g.recordSightings(player, previous)
+			if !g.fillLikelihood(grid, player, ours, true) {
+				// The evidence contradicts our assumptions, fall back to any unseen cell
+				g.fillLikelihood(grid, player, ours, false)
+			}
+		}
+		g.inference.grids[player] = grid
+	}
+}
+
+// Fills the grid with the normalized likelihood of each cell holding the player's general.
+// Strict applies the spawn distance and how far the player could have expanded by now.
+// Returns false if no cell is possible.
+func (g *Game) fillLikelihood(grid []float64, player, ours int, strict bool) bool {
+	minDistance := g.MinGeneralDistance
+	if minDistance == 0 {
+		minDistance = DefaultMinGeneralDistance
+	}
+	territory := []int{}
+	for cell, m := range g.Memory {
+		if m.Faction == player {
+			territory = append(territory, cell)
+		}
+	}
+	sightings := g.inference.sightings[player]
+
+	total := 0.0
+	for cell := range grid {
+		grid[cell] = 0
+		if !g.couldSpawn(cell) {
+			continue
+		}
+		if strict && ours >= 0 && g.GetDistance(cell, ours) < minDistance {
+			continue
+		}
+
+		likelihood := 1.0
+		for _, owned := range territory {
+			d := g.GetDistance(cell, owned)
+			// The player captures at most one cell each update, starting from their general
+			if strict && d > g.Memory[owned].Turn {
+				likelihood = 0
+				break
+			}
+			likelihood += 1 / float64(1+d)
+		}
+		if likelihood == 0 {
+			continue
+		}
+		for _, s := range sightings {
+			likelihood += float64(s.armies) / float64(1+g.GetDistance(cell, s.cell))
+		}
+		grid[cell] = likelihood
+		total += likelihood
+	}
+
+	if total == 0 {
+		return false
+	}
+	for cell := range grid {
+		grid[cell] /= total
+	}
+	return true
+}
+
+// Returns true if a general could be on the cell. Generals are placed on empty cells, and are
+// revealed by the server whenever they are in sight, so cells we have seen are ruled out.
+func (g *Game) couldSpawn(cell int) bool {
+	m := g.Memory[cell]
+	return !m.Seen && m.Type == Fog
+}
+
+// Records the player's armies which came into sight, or captured a visible cell, this update.
+// The army came from the fog next to it, so that cell is recorded as where it came from.
+func (g *Game) recordSightings(player int, previous []Cell) {
+	if len(previous) != len(g.GameMap) {
+		return
+	}
+	sightings := g.inference.sightings[player]
+	for cell, c := range g.GameMap {
+		if !c.Visible || c.Faction != player || c.Armies <= 1 {
+			continue
+		}
+		if previous[cell].Visible && previous[cell].Faction == player {
+			continue
+		}
+		origin := cell
+		for _, adjacent := range g.GetAdjacents(cell) {
+			if !g.GameMap[adjacent].Visible {
+				origin = adjacent
+				break
+			}
+		}
+		sightings = append(sightings, sighting{origin, c.Armies})
+	}
+	if len(sightings) > maxSightings {
+		sightings = sightings[len(sightings)-maxSightings:]
+	}
+	g.inference.sightings[player] = sightings
+}
+
+// Returns true if the player has been eliminated
+func (g *Game) isDead(player int) bool {
+	for _, score := range g.Scores {
+		if score.Index == player {
+			return score.Dead
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package game
+
+import (
+	"math"
+	"testing"
+)
+
+// Returns an update of a width x height map in fog, except for our general at cell 0
+func fogUpdate(turn, width, height int) testUpdate {
+	u := testUpdate{
+		turn:     turn,
+		armies:   repeat(0, width*height),
+		terrain:  repeat(tileFog, width*height),
+		generals: []int{0, -1},
+	}
+	u.armies[0] = 1
+	u.terrain[0] = 0
+	return u
+}
+
+// Fails the test unless the grid sums to 1
+func checkNormalized(t *testing.T, grid []float64) {
+	t.Helper()
+	total := 0.0
+	for _, likelihood := range grid {
+		total += likelihood
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("likelihoods sum to %v, want 1", total)
+	}
+}
+
+func TestInferMinDistance(t *testing.T) {
+	g := startTestGame(t, 0, nil, nil)
+	g.MinGeneralDistance = 5
+	sendTestUpdate(t, g, 12, 1, fogUpdate(1, 12, 1))
+
+	grid := g.GeneralLikelihood(1)
+	if grid == nil {
+		t.Fatal("GeneralLikelihood(1) = nil for an enemy")
+	}
+	for cell, likelihood := range grid {
+		if close := cell < 5; close != (likelihood == 0) {
+			t.Errorf("likelihood of cell %v at distance %v = %v", cell, cell, likelihood)
+		}
+	}
+	checkNormalized(t, grid)
+	if g.GeneralLikelihood(0) != nil {
+		t.Error("GeneralLikelihood(0) is set for ourselves")
+	}
+}
+
+func TestInferFallsBackWhenNoCellIsFarEnough(t *testing.T) {
+	g := startTestGame(t, 0, nil, nil)
+	g.MinGeneralDistance = 20
+	sendTestUpdate(t, g, 12, 1, fogUpdate(1, 12, 1))
+
+	// No cell is 20 away on a 12 cell map, so every unseen cell is possible
+	grid := g.GeneralLikelihood(1)
+	for cell, likelihood := range grid {
+		if unseen := cell > 0; unseen != (likelihood > 0) {
+			t.Errorf("likelihood of cell %v = %v", cell, likelihood)
+		}
+	}
+	checkNormalized(t, grid)
+}
+
+func TestInferExpansionLimit(t *testing.T) {
+	g := startTestGame(t, 0, nil, nil)
+	g.MinGeneralDistance = 1
+	// The enemy owns cell 8 on update 2, so their general is at most 2 cells away from it
+	u := fogUpdate(2, 12, 1)
+	u.armies[8], u.terrain[8] = 1, 1
+	sendTestUpdate(t, g, 12, 1, u)
+
+	for cell, likelihood := range g.GeneralLikelihood(1) {
+		possible := cell != 0 && cell != 8 && cell >= 6 && cell <= 10
+		if possible != (likelihood > 0) {
+			t.Errorf("likelihood of cell %v = %v", cell, likelihood)
+		}
+	}
+}
+
+func TestInferRevealedGeneral(t *testing.T) {
+	g := startTestGame(t, 0, nil, nil)
+	u := fogUpdate(1, 12, 1)
+	u.armies[10], u.terrain[10] = 3, 1
+	u.generals = []int{0, 10}
+	sendTestUpdate(t, g, 12, 1, u)
+
+	candidates := g.GeneralCandidates(1, 5)
+	want := Candidate{Cell: 10, Player: 1, Likelihood: 1}
+	if len(candidates) != 1 || candidates[0] != want {
+		t.Errorf("GeneralCandidates = %+v, want only %+v", candidates, want)
+	}
+	if likely := g.LikelyGenerals(1); len(likely) != 1 || likely[0] != want {
+		t.Errorf("LikelyGenerals = %+v, want %+v", likely, want)
+	}
+}
+
+func TestInferSkipsAllies(t *testing.T) {
+	g := startTestGame(t, 0, nil, []int{1, 1, 2})
+	u := fogUpdate(1, 12, 1)
+	u.generals = []int{0, -1, -1}
+	sendTestUpdate(t, g, 12, 1, u)
+
+	if g.GeneralLikelihood(1) != nil {
+		t.Error("GeneralLikelihood is set for an ally")
+	}
+	if g.GeneralLikelihood(2) == nil {
+		t.Error("GeneralLikelihood is nil for an enemy")
+	}
+}
+
+func TestInferSightingsChangeRanking(t *testing.T) {
+	const width, height = 10, 10
+	g := startTestGame(t, 0, nil, nil)
+	sendTestUpdate(t, g, width, height, fogUpdate(100, width, height))
+
+	// Without evidence every cell far enough from us is as likely, the first one ranks highest
+	before := g.GeneralCandidates(1, 1)
+	if len(before) != 1 || before[0].Cell != 9 {
+		t.Fatalf("GeneralCandidates before the sighting = %+v, want cell 9", before)
+	}
+
+	// A large enemy army comes out of the fog in the bottom row
+	sighted := 9*width + 5
+	u := fogUpdate(102, width, height)
+	u.armies[sighted], u.terrain[sighted] = 20, 1
+	sendTestUpdate(t, g, width, height, u)
+
+	after := g.GeneralCandidates(1, 3)
+	if len(after) != 3 {
+		t.Fatalf("GeneralCandidates after the sighting = %+v", after)
+	}
+	for _, c := range after {
+		if d := g.GetDistance(c.Cell, sighted); d > 2 {
+			t.Errorf("candidate %+v is %v cells from the sighting, want at most 2", c, d)
+		}
+	}
+	if after[0].Likelihood <= before[0].Likelihood {
+		t.Errorf("top likelihood = %v after the sighting, want more than %v", after[0].Likelihood, before[0].Likelihood)
+	}
+
+	// The army stays in sight, so it is not counted again
+	sendTestUpdate(t, g, width, height, u)
+	if n := len(g.inference.sightings[1]); n != 1 {
+		t.Errorf("recorded %v sightings of an army which stayed in sight, want 1", n)
+	}
+}
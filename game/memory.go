@@ -0,0 +1,87 @@
+package game
+
+// Memory is the last observed state of a cell, which is kept while the cell is in fog
+type Memory struct {
+	Armies int
+	Type   CellType
+	// Index of the player who owned the cell, Neutral, or Unknown if it was never seen
+	Faction int
+	// True once the cell has been visible
+	Seen bool
+	// TurnCount of the update in which the cell was last visible
+	Turn int
+}
+
+// Returns the memory of a map which has not been seen yet
+func newMemory(size int) []Memory {
+	memory := make([]Memory, size)
+	for i := range memory {
+		memory[i] = Memory{Type: Fog, Faction: Unknown}
+	}
+	return memory
+}
+
+// Updates the memory of a cell with its state this turn
+func (m *Memory) observe(c Cell, turn int) {
+	if c.Visible {
+		*m = Memory{Armies: c.Armies, Type: c.Type, Faction: c.Faction, Seen: true, Turn: turn}
+		return
+	}
+
+	// Out of sight, only learn the terrain the server still tells us about
+	switch c.Type {
+	case City, General, Swamp:
+		m.Type = c.Type
+	case FogObstacle:
+		if m.Type != Mountain && m.Type != City {
+			m.Type = FogObstacle
+		}
+	}
+}
+
+// Remembered returns the last observed state of a cell
+func (g *Game) Remembered(cell int) Memory {
+	return g.Memory[cell]
+}
+
+// IsEnemy returns true if the faction is a player other than us or a teammate
+func (g *Game) IsEnemy(faction int) bool {
+	if faction < 0 || faction == g.PlayerIndex {
+		return false
+	}
+	if faction < len(g.teams) && g.PlayerIndex < len(g.teams) {
+		return g.teams[faction] != g.teams[g.PlayerIndex]
+	}
+	return true
+}
+
+// KnownEnemyCities returns the cells last seen as cities owned by an enemy
+func (g *Game) KnownEnemyCities() []int {
+	return g.remembered(func(m Memory) bool {
+		return m.Type == City && g.IsEnemy(m.Faction)
+	})
+}
+
+// KnownEnemyGenerals returns the cells last seen as generals owned by an enemy
+func (g *Game) KnownEnemyGenerals() []int {
+	return g.remembered(func(m Memory) bool {
+		return m.Type == General && g.IsEnemy(m.Faction)
+	})
+}
+
+// StaleCells returns the cells which were seen, but not for more than the given number of turns
+func (g *Game) StaleCells(turns int) []int {
+	return g.remembered(func(m Memory) bool {
+		return m.Seen && g.TurnCount-m.Turn > turns*TicksPerTurn
+	})
+}
+
+// Returns the cells whose memory matches
+func (g *Game) remembered(match func(m Memory) bool) (cells []int) {
+	for i, m := range g.Memory {
+		if match(m) {
+			cells = append(cells, i)
+		}
+	}
+	return
+}
@@ -1,5 +1,5 @@
 module github.com/brisberg/generals-io-bot
 
-go 1.14
+go 1.18
 
 require github.com/gorilla/websocket v1.4.1
@@ -0,0 +1,187 @@
+// Package logger provides the leveled, structured logger used by the client and game packages.
+//
+// Entries are a message and a list of alternating keys and values, such as
+// `l.Info("Joined queue", "queue", "1v1", "user", "[Bot]me")`. Implementations may be swapped for
+// any logging library by implementing Logger.
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Logger logs leveled messages with structured key-value fields
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+	// With returns a Logger which adds the key-value fields to every entry
+	With(kv ...interface{}) Logger
+}
+
+// Level is the severity of a log entry
+type Level int
+
+const (
+	// LevelDebug is used for high volume entries, such as every frame sent or received
+	LevelDebug Level = iota
+	// LevelInfo is used for lifecycle events, such as joining a lobby or a game starting
+	LevelInfo
+	// LevelWarn is used for recoverable errors
+	LevelWarn
+	// LevelError is used for errors which stop the client or game
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// stdLogger writes entries as text lines through the standard log package
+type stdLogger struct {
+	out    *log.Logger
+	level  Level
+	fields []interface{}
+}
+
+// New returns a Logger writing entries at or above the level to w, as
+// `2006/01/02 15:04:05 INFO message key=value ...`
+func New(w io.Writer, level Level) Logger {
+	return &stdLogger{out: log.New(w, "", log.LstdFlags), level: level}
+}
+
+// Default returns a Logger writing Info and higher entries to stderr
+func Default() Logger {
+	return New(os.Stderr, LevelInfo)
+}
+
+func (l *stdLogger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+func (l *stdLogger) Info(msg string, kv ...interface{})  { l.log(LevelInfo, msg, kv) }
+func (l *stdLogger) Warn(msg string, kv ...interface{})  { l.log(LevelWarn, msg, kv) }
+func (l *stdLogger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+func (l *stdLogger) With(kv ...interface{}) Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(append(fields, l.fields...), kv...)
+	return &stdLogger{out: l.out, level: l.level, fields: fields}
+}
+
+func (l *stdLogger) log(level Level, msg string, kv []interface{}) {
+	if level < l.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	writeFields(&b, l.fields)
+	writeFields(&b, kv)
+	l.out.Output(3, b.String())
+}
+
+// Appends key=value pairs. A key without a value is logged with the value MISSING
+func writeFields(b *strings.Builder, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		var v interface{} = "MISSING"
+		if i+1 < len(kv) {
+			v = kv[i+1]
+		}
+		s := fmt.Sprint(v)
+		if strings.ContainsAny(s, " \t\n\"=") {
+			s = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(b, " %v=%v", kv[i], s)
+	}
+}
+
+// nopLogger discards every entry
+type nopLogger struct{}
+
+// Nop returns a Logger which discards every entry
+func Nop() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+func (nopLogger) With(...interface{}) Logger   { return nopLogger{} }
+
+// sampledLogger passes one in every n Debug and Info entries to the wrapped Logger
+type sampledLogger struct {
+	l     Logger
+	n     uint64
+	count *uint64
+}
+
+// Sample returns a Logger which passes only the first of every n Debug and Info entries to l, for
+// silencing high volume entries such as frame logs. Warn and Error entries are always passed.
+// Loggers returned by With share the count.
+func Sample(l Logger, n int) Logger {
+	if n <= 1 {
+		return l
+	}
+	return &sampledLogger{l: l, n: uint64(n), count: new(uint64)}
+}
+
+func (s *sampledLogger) sampled() bool {
+	return (atomic.AddUint64(s.count, 1)-1)%s.n == 0
+}
+
+func (s *sampledLogger) Debug(msg string, kv ...interface{}) {
+	if s.sampled() {
+		s.l.Debug(msg, kv...)
+	}
+}
+
+func (s *sampledLogger) Info(msg string, kv ...interface{}) {
+	if s.sampled() {
+		s.l.Info(msg, kv...)
+	}
+}
+
+func (s *sampledLogger) Warn(msg string, kv ...interface{})  { s.l.Warn(msg, kv...) }
+func (s *sampledLogger) Error(msg string, kv ...interface{}) { s.l.Error(msg, kv...) }
+
+func (s *sampledLogger) With(kv ...interface{}) Logger {
+	return &sampledLogger{l: s.l.With(kv...), n: s.n, count: s.count}
+}
+
+var (
+	defaultMu sync.Mutex
+	fallback  = Default()
+)
+
+// SetDefault replaces the Logger returned by Or when no Logger is configured
+func SetDefault(l Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	fallback = l
+}
+
+// Or returns l, or the default Logger if l is nil
+func Or(l Logger) Logger {
+	if l != nil {
+		return l
+	}
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return fallback
+}
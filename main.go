@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
@@ -9,99 +12,162 @@ import (
 
 	"github.com/brisberg/generals-io-bot/client"
 	"github.com/brisberg/generals-io-bot/game"
+	"github.com/brisberg/generals-io-bot/logger"
+	"github.com/brisberg/generals-io-bot/supervisor"
+)
+
+var (
+	record = flag.String("record", "", "Record the traffic with the server to this capture file")
+	replay = flag.String("replay", "", "Replay a capture file into a game instead of connecting")
+	debug  = flag.Bool("debug", false, "Log every frame sent and received")
+
+	accountsFile = flag.String("accounts", "", "JSON file listing the bot accounts to run")
 )
 
 func main() {
+	flag.Parse()
 	fmt.Printf("Starting Generals AI Program:\n")
-
-	c, err := client.Connect("bot")
-	if err != nil {
-		log.Fatal(err)
+	if *debug {
+		logger.SetDefault(logger.New(os.Stderr, logger.LevelDebug))
 	}
-	defer c.Close("Main Program Terminated")
 
-	c.OnClose = func() {
-		log.Println("Close Callback. Exiting.")
-		os.Exit(1)
+	if *replay != "" {
+		if err := replayCapture(*replay); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	// c.UseGameConstructor(func() client.IGame {
-	// 	return &game.Game{}
-	// })
-
-	go c.Run()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	if err := c.RegisterBot("mybot-batz", "[Bot]Keidence-45"); err != nil {
-		log.Fatalln(err)
+	accounts := []supervisor.Account{
+		{UserID: "mybot-batz", Username: "[Bot]Keidence-45", Lobby: "botbotbot"},
+	}
+	if *accountsFile != "" {
+		var err error
+		if accounts, err = loadAccounts(*accountsFile); err != nil {
+			log.Fatal(err)
+		}
 	}
-	time.Sleep(2000 * time.Millisecond)
 
-	// Launch a go routine for playing the game. Listens on the game events queue
-	// var g *game.Game
-	g := &game.Game{}
-	gameEvents := make(chan client.NetworkEvent)
-	c.SetGameEventChan(gameEvents)
-	go func(gameEvents <-chan client.NetworkEvent, g *game.Game) {
-		for evt := range gameEvents {
-			switch evt.Name {
-			case "pre_game_start":
-				// g = &game.Game{}
-				g.PreGameStart()
-			case "game_start":
-				g.GameStart(evt.Data)
-			case "game_update":
-				g.GameUpdate(evt.Data)
-			case "game_won":
-				g.GameWon()
-			case "game_lost":
-				g.GameLost()
-			case "game_over":
-				g.GameOver()
-				// g = nil
-			}
+	options := client.Options{URL: client.ServerURL("bot")}
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			log.Fatal(err)
 		}
-	}(gameEvents, g)
+		defer f.Close()
+		options.Recorder = client.NewRecorder(f)
+	}
 
-	c.JoinCustomGame("botbotbot")
-	time.Sleep(3000 * time.Millisecond)
+	// Play games until the program is stopped, with a fresh game instance for each
+	s := &supervisor.Supervisor{
+		Options:         options,
+		ReconnectPolicy: client.DefaultReconnectPolicy(),
+		Session: client.Session{
+			RejoinDelay: 2 * time.Second,
+			ForceStart:  true,
+			OnGameResult: func(r client.GameResult) {
+				log.Printf("Game %v over, won: %v. Replay at http://bot.generals.io/replays/%v", r.Number, r.Won, r.ReplayID)
+			},
+		},
+		Strategy: supervisor.StrategyFunc(playRandom),
+	}
+	for _, a := range accounts {
+		s.Add(a)
+	}
 
-	c.SetForceStart(true)
-	time.Sleep(3000 * time.Millisecond)
+	go reportStatus(ctx, s)
+	if err := s.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Reads the accounts to run from a JSON file
+func loadAccounts(path string) ([]supervisor.Account, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return supervisor.LoadAccounts(f)
+}
 
+// Logs the status of every account each minute
+func reportStatus(ctx context.Context, s *supervisor.Supervisor) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 	for {
-		time.Sleep(5000 * time.Millisecond)
-		if g != nil {
-			log.Println("Game has started, starting bot...")
-			for {
-				time.Sleep(100 * time.Millisecond)
-				if g.QueueLength() > 0 {
-					continue
-				}
-				mine := []int{}
-				for i, tile := range g.GameMap {
-					if tile.Faction == g.PlayerIndex && tile.Armies > 1 {
-						mine = append(mine, i)
-					}
-				}
-				if len(mine) == 0 {
-					continue
-				}
-				cell := rand.Intn(len(mine))
-				move := []int{}
-				for _, adjacent := range g.GetAdjacents(mine[cell]) {
-					if g.Walkable(adjacent) {
-						move = append(move, adjacent)
-					}
-				}
-				if len(move) == 0 {
-					continue
-				}
-				movecell := rand.Intn(len(move))
-				c.Attack(mine[cell], move[movecell], false, g.NextAttackIndex())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		for _, st := range s.Status() {
+			log.Printf("%v: %v, %v/%v games won, %v restarts", st.Username, st.State, st.Wins, st.Games, st.Restarts)
+		}
+	}
+}
+
+// Moves random armies to random adjacent tiles until the game is over
+func playRandom(ctx context.Context, c *client.Client, g *game.Game) error {
+	log.Println("Game has started, starting bot...")
+	for {
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return nil
+		}
+		if g.QueueLength() > 0 {
+			continue
+		}
+		s := g.Snapshot()
+		mine := []game.Coord{}
+		for _, at := range s.Coords() {
+			if tile := s.CellAt(at); tile.Faction == s.PlayerIndex && tile.Armies > 1 {
+				mine = append(mine, at)
+			}
+		}
+		if len(mine) == 0 {
+			continue
+		}
+		from := mine[rand.Intn(len(mine))]
+		move := []game.Coord{}
+		for _, adjacent := range s.GetAdjacentsAt(from) {
+			if s.WalkableAt(adjacent) {
+				move = append(move, adjacent)
 			}
 		}
+		if len(move) == 0 {
+			continue
+		}
+		to := move[rand.Intn(len(move))]
+		c.AttackCoord(from.X, from.Y, to.X, to.Y, s.Width, false, g.NextAttackIndex())
+	}
+}
+
+// Plays a capture recorded with -record back into a game, without connecting to a server
+func replayCapture(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 
-	// c.LeaveLobby()
-	// time.Sleep(10000 * time.Millisecond)
+	r, err := client.NewReplayer(f, client.Options{})
+	if err != nil {
+		return err
+	}
+
+	// Dispatch synchronously, so the game sees every frame before the next one is replayed
+	g := &game.Game{}
+	r.Client.On(client.AnyEvent, func(raw json.RawMessage) {
+		g.Dispatch(client.EventName(raw), raw)
+	})
+	if err := r.Run(context.Background()); err != nil {
+		return err
+	}
+	log.Printf("Replayed %v frames, ending on turn %v", len(r.Frames()), g.TurnCount)
+	return nil
 }
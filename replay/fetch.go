@@ -0,0 +1,71 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// DefaultBaseURL is where the replays of the main Generals.io servers are stored
+	DefaultBaseURL = "https://generalsio-replays-na.s3.amazonaws.com"
+	// BotBaseURL is where the replays of the bot server are stored
+	BotBaseURL = "https://generalsio-replays-bot.s3.amazonaws.com"
+)
+
+// Fetcher downloads replays by ID
+type Fetcher struct {
+	// URL the replay files are stored under, as <BaseURL>/<ID>.gior. Defaults to DefaultBaseURL
+	BaseURL string
+	// HTTP client used for downloads. Nil uses http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Fetch downloads and decodes the replay with the given ID from the main servers
+func Fetch(ctx context.Context, ID string) (*Replay, error) {
+	return (&Fetcher{}).Fetch(ctx, ID)
+}
+
+// Fetch downloads and decodes the replay with the given ID
+func (f *Fetcher) Fetch(ctx context.Context, ID string) (*Replay, error) {
+	data, err := f.FetchRaw(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+// FetchRaw downloads the .gior file of the replay with the given ID without decoding it
+func (f *Fetcher) FetchRaw(ctx context.Context, ID string) ([]byte, error) {
+	if ID == "" {
+		return nil, errors.New("Error: Must specify a replay ID")
+	}
+	base := f.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	u := strings.TrimSuffix(base, "/") + "/" + url.PathEscape(ID) + ".gior"
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := f.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Error: Could not fetch replay %v: %v", ID, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
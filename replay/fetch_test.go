@@ -0,0 +1,119 @@
+package replay
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Serves testdata/HxYz12abc.gior under /replays, recording the paths requested
+func newReplayServer(t *testing.T) (*httptest.Server, *[]string) {
+	data, err := os.ReadFile("testdata/HxYz12abc.gior")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := &[]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*paths = append(*paths, r.URL.EscapedPath())
+		switch r.URL.Path {
+		case "/replays/HxYz12abc.gior":
+			w.Write(data)
+		case "/replays/broken.gior":
+			w.Write([]byte("not a replay"))
+		case "/replays/private.gior":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, paths
+}
+
+func TestFetch(t *testing.T) {
+	srv, paths := newReplayServer(t)
+	f := &Fetcher{BaseURL: srv.URL + "/replays/", HTTPClient: srv.Client()}
+
+	r, err := f.Fetch(context.Background(), "HxYz12abc")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if !reflect.DeepEqual(r, fixture) {
+		t.Errorf("Fetch = %+v, want %+v", r, fixture)
+	}
+	// The trailing slash of the base URL is not doubled
+	if want := []string{"/replays/HxYz12abc.gior"}; !reflect.DeepEqual(*paths, want) {
+		t.Errorf("requested %v, want %v", *paths, want)
+	}
+}
+
+func TestFetchRawEscapesID(t *testing.T) {
+	srv, paths := newReplayServer(t)
+	f := &Fetcher{BaseURL: srv.URL + "/replays", HTTPClient: srv.Client()}
+
+	if _, err := f.FetchRaw(context.Background(), "a/b c"); err == nil {
+		t.Error("FetchRaw of a missing replay = nil, want an error")
+	}
+	if want := []string{"/replays/a%2Fb%20c.gior"}; !reflect.DeepEqual(*paths, want) {
+		t.Errorf("requested %v, want %v", *paths, want)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	srv, _ := newReplayServer(t)
+	f := &Fetcher{BaseURL: srv.URL + "/replays", HTTPClient: srv.Client()}
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"", "Must specify a replay ID"},
+		{"missing", "404 Not Found"},
+		{"private", "403 Forbidden"},
+		{"broken", ""},
+	}
+	for _, tt := range tests {
+		r, err := f.Fetch(context.Background(), tt.id)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Fetch(%q) = %v, %v, want an error containing %q", tt.id, r, err, tt.want)
+		}
+	}
+}
+
+func TestFetchContext(t *testing.T) {
+	srv, paths := newReplayServer(t)
+	f := &Fetcher{BaseURL: srv.URL, HTTPClient: srv.Client()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.FetchRaw(ctx, "HxYz12abc"); err == nil {
+		t.Error("FetchRaw with a cancelled context = nil, want an error")
+	}
+	if len(*paths) != 0 {
+		t.Errorf("requested %v with a cancelled context", *paths)
+	}
+}
+
+// Transport which answers every request with a 404
+type recordingTransport struct {
+	urls []string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.urls = append(rt.urls, req.URL.String())
+	return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: http.NoBody, Request: req}, nil
+}
+
+func TestFetchDefaultBaseURL(t *testing.T) {
+	rt := &recordingTransport{}
+	f := &Fetcher{HTTPClient: &http.Client{Transport: rt}}
+	f.FetchRaw(context.Background(), "HxYz12abc")
+
+	if want := []string{DefaultBaseURL + "/HxYz12abc.gior"}; !reflect.DeepEqual(rt.urls, want) {
+		t.Errorf("requested %v, want %v", rt.urls, want)
+	}
+}
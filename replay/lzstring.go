@@ -0,0 +1,240 @@
+package replay
+
+import (
+	"errors"
+	"unicode/utf16"
+)
+
+// ErrCorrupt is returned when compressed replay data can not be decompressed
+var ErrCorrupt = errors.New("Error: Corrupt LZString data")
+
+// DecompressUint8Array decompresses data produced by LZString.compressToUint8Array, the format of
+// .gior replay files
+func DecompressUint8Array(data []byte) (string, error) {
+	// Every character is two bytes, so a trailing odd byte means the data was truncated
+	if len(data)%2 != 0 {
+		return "", ErrCorrupt
+	}
+	codes := make([]uint16, len(data)/2)
+	for i := range codes {
+		codes[i] = uint16(data[i*2])<<8 | uint16(data[i*2+1])
+	}
+	out, err := decompress(codes, 16)
+	if err != nil {
+		return "", err
+	}
+	return string(utf16.Decode(out)), nil
+}
+
+// CompressUint8Array compresses a string like LZString.compressToUint8Array
+func CompressUint8Array(s string) []byte {
+	codes := compress(utf16.Encode([]rune(s)), 16)
+	data := make([]byte, len(codes)*2)
+	for i, c := range codes {
+		data[i*2] = byte(c >> 8)
+		data[i*2+1] = byte(c)
+	}
+	return data
+}
+
+// Reads values of a given bit width from a stream of characters, least significant bit first
+type bitReader struct {
+	codes    []uint16
+	index    int
+	val      uint16
+	position uint16
+	reset    uint16
+}
+
+func (r *bitReader) read(numBits uint) int {
+	bits := 0
+	for power := 0; power < int(numBits); power++ {
+		if r.val&r.position != 0 {
+			bits |= 1 << power
+		}
+		r.position >>= 1
+		if r.position == 0 {
+			r.position = r.reset
+			r.val = 0
+			if r.index < len(r.codes) {
+				r.val = r.codes[r.index]
+			}
+			r.index++
+		}
+	}
+	return bits
+}
+
+// Port of LZString._decompress for characters of bitsPerChar bits
+func decompress(codes []uint16, bitsPerChar uint) ([]uint16, error) {
+	if len(codes) == 0 {
+		return nil, ErrCorrupt
+	}
+	r := &bitReader{codes: codes, index: 1, val: codes[0], reset: 1 << (bitsPerChar - 1)}
+	r.position = r.reset
+
+	dictionary := [][]uint16{{0}, {1}, {2}}
+	enlargeIn := 4
+	numBits := uint(3)
+
+	var w []uint16
+	switch r.read(2) {
+	case 0:
+		w = []uint16{uint16(r.read(8))}
+	case 1:
+		w = []uint16{uint16(r.read(16))}
+	case 2:
+		return nil, nil
+	default:
+		return nil, ErrCorrupt
+	}
+	dictionary = append(dictionary, w)
+	result := append([]uint16{}, w...)
+
+	for {
+		if r.index > len(codes) {
+			return nil, ErrCorrupt
+		}
+		c := r.read(numBits)
+		switch c {
+		case 0, 1:
+			width := uint(8)
+			if c == 1 {
+				width = 16
+			}
+			dictionary = append(dictionary, []uint16{uint16(r.read(width))})
+			c = len(dictionary) - 1
+			enlargeIn--
+		case 2:
+			return result, nil
+		}
+		if enlargeIn == 0 {
+			enlargeIn = 1 << numBits
+			numBits++
+		}
+
+		var entry []uint16
+		if c < len(dictionary) {
+			entry = dictionary[c]
+		} else if c == len(dictionary) {
+			entry = append(append([]uint16{}, w...), w[0])
+		} else {
+			return nil, ErrCorrupt
+		}
+		result = append(result, entry...)
+
+		dictionary = append(dictionary, append(append([]uint16{}, w...), entry[0]))
+		enlargeIn--
+		w = entry
+		if enlargeIn == 0 {
+			enlargeIn = 1 << numBits
+			numBits++
+		}
+	}
+}
+
+// Writes values of a given bit width as characters, least significant bit first
+type bitWriter struct {
+	codes       []uint16
+	val         uint16
+	position    uint
+	bitsPerChar uint
+}
+
+func (w *bitWriter) write(value int, numBits uint) {
+	for i := uint(0); i < numBits; i++ {
+		w.val = w.val<<1 | uint16(value&1)
+		if w.position == w.bitsPerChar-1 {
+			w.position = 0
+			w.codes = append(w.codes, w.val)
+			w.val = 0
+		} else {
+			w.position++
+		}
+		value >>= 1
+	}
+}
+
+// Pads the last character with zeros
+func (w *bitWriter) flush() {
+	for {
+		w.val <<= 1
+		if w.position == w.bitsPerChar-1 {
+			w.codes = append(w.codes, w.val)
+			return
+		}
+		w.position++
+	}
+}
+
+// Port of LZString._compress for characters of bitsPerChar bits
+func compress(input []uint16, bitsPerChar uint) []uint16 {
+	out := &bitWriter{bitsPerChar: bitsPerChar}
+	dictionary := map[string]int{}
+	toCreate := map[string]bool{}
+	enlargeIn := 2
+	dictSize := 3
+	numBits := uint(2)
+
+	grow := func() {
+		enlargeIn--
+		if enlargeIn == 0 {
+			enlargeIn = 1 << numBits
+			numBits++
+		}
+	}
+	emit := func(w []uint16) {
+		k := key(w)
+		if toCreate[k] {
+			if w[0] < 256 {
+				out.write(0, numBits)
+				out.write(int(w[0]), 8)
+			} else {
+				out.write(1, numBits)
+				out.write(int(w[0]), 16)
+			}
+			grow()
+			delete(toCreate, k)
+		} else {
+			out.write(dictionary[k], numBits)
+		}
+		grow()
+	}
+
+	var w []uint16
+	for _, c := range input {
+		ck := key([]uint16{c})
+		if _, ok := dictionary[ck]; !ok {
+			dictionary[ck] = dictSize
+			dictSize++
+			toCreate[ck] = true
+		}
+		wc := append(append([]uint16{}, w...), c)
+		if _, ok := dictionary[key(wc)]; ok {
+			w = wc
+			continue
+		}
+		emit(w)
+		dictionary[key(wc)] = dictSize
+		dictSize++
+		w = []uint16{c}
+	}
+	if len(w) > 0 {
+		emit(w)
+	}
+
+	// Mark the end of the stream
+	out.write(2, numBits)
+	out.flush()
+	return out.codes
+}
+
+// Returns a map key for a sequence of characters
+func key(s []uint16) string {
+	b := make([]byte, len(s)*2)
+	for i, c := range s {
+		b[i*2] = byte(c >> 8)
+		b[i*2+1] = byte(c)
+	}
+	return string(b)
+}
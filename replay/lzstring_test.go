@@ -0,0 +1,55 @@
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompressUint8ArrayVector(t *testing.T) {
+	// LZString.compressToUint8Array("hello") in JavaScript
+	want := []byte{5, 133, 48, 54, 96, 246, 64, 0}
+	if got := CompressUint8Array("hello"); !bytes.Equal(got, want) {
+		t.Errorf("CompressUint8Array(hello) = %v, want %v", got, want)
+	}
+	s, err := DecompressUint8Array(want)
+	if err != nil || s != "hello" {
+		t.Errorf("DecompressUint8Array(%v) = %q, %v, want hello", want, s, err)
+	}
+}
+
+func TestLZStringRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"a",
+		"hello",
+		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		"abababababababababababababcabcabcabc",
+		"snow☃man 🎮 héllo",
+		strings.Repeat(`[0,12,13,false,41],[1,7,8,true,42],`, 200),
+	} {
+		got, err := DecompressUint8Array(CompressUint8Array(s))
+		if err != nil || got != s {
+			t.Errorf("round trip of %q = %q, %v", s, got, err)
+		}
+	}
+}
+
+func TestDecompressCorrupt(t *testing.T) {
+	valid := CompressUint8Array("hello")
+	for _, data := range [][]byte{
+		nil,
+		// Odd number of bytes
+		valid[:len(valid)-1],
+		append(append([]byte{}, valid...), 0),
+		// Truncated before the end of stream marker
+		valid[:2],
+		// First character flagged with the reserved value 3
+		{0xc0, 0},
+	} {
+		if _, err := DecompressUint8Array(data); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("DecompressUint8Array(%v) = %v, want %v", data, err, ErrCorrupt)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package replay decodes Generals.io replays (.gior files) and downloads them by ID.
+//
+// A .gior file is a JSON array compressed with LZString.compressToUint8Array. Its elements are, in
+// order: version, ID, map width, map height, usernames, stars, cities, city armies, generals,
+// mountains, moves, AFKs, teams, map title, neutrals, neutral armies, swamps, chat and player
+// colors. Elements added by newer replay versions are optional.
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Replay is a decoded Generals.io replay. Tiles are map indices, row * Width + column
+type Replay struct {
+	Version int
+	ID      string
+	Width   int
+	Height  int
+	// Usernames of the players, by player index
+	Usernames []string
+	// Star ratings of the players, by player index
+	Stars []float64
+	// Tiles of the cities and their starting armies
+	Cities     []int
+	CityArmies []int
+	// Tiles of the generals, by player index
+	Generals  []int
+	Mountains []int
+	Moves     []Move
+	AFKs      []AFK
+	// Team of each player, by player index. Nil for games without teams
+	Teams []int
+	// Title of the custom map, empty for generated maps
+	MapTitle string
+	// Tiles of neutral armies and their sizes
+	Neutrals      []int
+	NeutralArmies []int
+	Swamps        []int
+	Chat          []ChatMessage
+	// Color index of each player, by player index
+	PlayerColors []int
+}
+
+// Move is an attack made by a player
+type Move struct {
+	// Index of the player who moved
+	Index int
+	Start int
+	End   int
+	// True if only half of the army moved
+	Is50 bool
+	Turn int
+}
+
+// AFK records the turn a player went AFK
+type AFK struct {
+	Index int
+	Turn  int
+}
+
+// ChatMessage is a message sent in the game chat
+type ChatMessage struct {
+	Text string
+	// Prefix shown before the message, usually the username
+	Prefix      string
+	PlayerIndex int
+	Turn        int
+}
+
+// Decode decodes the contents of a .gior replay file
+func Decode(data []byte) (*Replay, error) {
+	text, err := DecompressUint8Array(data)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeJSON([]byte(text))
+}
+
+// DecodeJSON decodes a replay from its decompressed JSON array
+func DecodeJSON(data []byte) (*Replay, error) {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("Error: Invalid replay: %v", err)
+	}
+	if len(fields) < 12 {
+		return nil, fmt.Errorf("Error: Invalid replay: expected at least 12 fields, got %v", len(fields))
+	}
+
+	r := &Replay{}
+	moves := [][]json.RawMessage{}
+	afks := [][]int{}
+	chat := [][]json.RawMessage{}
+	targets := []interface{}{
+		&r.Version, &r.ID, &r.Width, &r.Height, &r.Usernames, &r.Stars, &r.Cities, &r.CityArmies,
+		&r.Generals, &r.Mountains, &moves, &afks, &r.Teams, &r.MapTitle, &r.Neutrals,
+		&r.NeutralArmies, &r.Swamps, &chat, &r.PlayerColors,
+	}
+	for i, target := range targets {
+		if i >= len(fields) {
+			break
+		}
+		if err := json.Unmarshal(fields[i], target); err != nil {
+			return nil, fmt.Errorf("Error: Invalid replay field %v: %v", i, err)
+		}
+	}
+
+	for _, m := range moves {
+		move, err := decodeMove(m)
+		if err != nil {
+			return nil, err
+		}
+		r.Moves = append(r.Moves, move)
+	}
+	for _, a := range afks {
+		if len(a) < 2 {
+			return nil, fmt.Errorf("Error: Invalid replay AFK %v", a)
+		}
+		r.AFKs = append(r.AFKs, AFK{Index: a[0], Turn: a[1]})
+	}
+	for _, c := range chat {
+		m := ChatMessage{}
+		msg := []interface{}{&m.Text, &m.Prefix, &m.PlayerIndex, &m.Turn}
+		for i := 0; i < len(c) && i < len(msg); i++ {
+			json.Unmarshal(c[i], msg[i])
+		}
+		r.Chat = append(r.Chat, m)
+	}
+	return r, nil
+}
+
+// Decodes a move serialized as [index, start, end, is50, turn]. is50 is a boolean or 0/1
+func decodeMove(fields []json.RawMessage) (Move, error) {
+	if len(fields) < 5 {
+		return Move{}, fmt.Errorf("Error: Invalid replay move with %v fields", len(fields))
+	}
+	m := Move{}
+	for i, target := range []interface{}{&m.Index, &m.Start, &m.End, nil, &m.Turn} {
+		if target == nil {
+			continue
+		}
+		if err := json.Unmarshal(fields[i], target); err != nil {
+			return Move{}, fmt.Errorf("Error: Invalid replay move: %v", err)
+		}
+	}
+	var flag interface{}
+	json.Unmarshal(fields[3], &flag)
+	switch v := flag.(type) {
+	case bool:
+		m.Is50 = v
+	case float64:
+		m.Is50 = v != 0
+	}
+	return m, nil
+}
+
+// EncodeJSON serializes a replay to its JSON array, the inverse of DecodeJSON
+func EncodeJSON(r *Replay) ([]byte, error) {
+	moves := make([][]interface{}, len(r.Moves))
+	for i, m := range r.Moves {
+		moves[i] = []interface{}{m.Index, m.Start, m.End, m.Is50, m.Turn}
+	}
+	afks := make([][]int, len(r.AFKs))
+	for i, a := range r.AFKs {
+		afks[i] = []int{a.Index, a.Turn}
+	}
+	chat := make([][]interface{}, len(r.Chat))
+	for i, m := range r.Chat {
+		chat[i] = []interface{}{m.Text, m.Prefix, m.PlayerIndex, m.Turn}
+	}
+	return json.Marshal([]interface{}{
+		r.Version, r.ID, r.Width, r.Height, r.Usernames, r.Stars, r.Cities, r.CityArmies,
+		r.Generals, r.Mountains, moves, afks, r.Teams, r.MapTitle, r.Neutrals,
+		r.NeutralArmies, r.Swamps, chat, r.PlayerColors,
+	})
+}
+
+// Encode serializes and compresses a replay to the .gior format, for example to write fixtures
+func Encode(r *Replay) ([]byte, error) {
+	data, err := EncodeJSON(r)
+	if err != nil {
+		return nil, err
+	}
+	return CompressUint8Array(string(data)), nil
+}
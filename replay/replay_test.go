@@ -0,0 +1,92 @@
+package replay
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// Replay stored in testdata/HxYz12abc.gior, which was compressed with the JavaScript LZString
+var fixture = &Replay{
+	Version:    7,
+	ID:         "HxYz12abc",
+	Width:      4,
+	Height:     3,
+	Usernames:  []string{"[Bot]alpha", "snow☃man 🎮"},
+	Stars:      []float64{52.5, 0},
+	Cities:     []int{5},
+	CityArmies: []int{40},
+	Generals:   []int{0, 11},
+	Mountains:  []int{3, 7},
+	Moves: []Move{
+		{Index: 0, Start: 0, End: 1, Is50: false, Turn: 1},
+		{Index: 1, Start: 11, End: 10, Is50: true, Turn: 2},
+		{Index: 0, Start: 1, End: 2, Is50: false, Turn: 3},
+		{Index: 1, Start: 10, End: 6, Is50: true, Turn: 5},
+	},
+	AFKs:          []AFK{{Index: 1, Turn: 24}},
+	Teams:         []int{1, 2},
+	MapTitle:      "Tiny Test Map",
+	Neutrals:      []int{9},
+	NeutralArmies: []int{12},
+	Swamps:        []int{8},
+	Chat: []ChatMessage{
+		{Text: "gg", Prefix: "[Bot]alpha", PlayerIndex: 0, Turn: 20},
+		{Text: "héllo ☃", Prefix: "snow☃man 🎮", PlayerIndex: 1, Turn: 22},
+	},
+	PlayerColors: []int{0, 1},
+}
+
+func TestDecode(t *testing.T) {
+	data, err := os.ReadFile("testdata/HxYz12abc.gior")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(r, fixture) {
+		t.Errorf("Decode = %+v, want %+v", r, fixture)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	data, err := Encode(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(r, fixture) {
+		t.Errorf("Decode(Encode()) = %+v, want %+v", r, fixture)
+	}
+}
+
+func TestDecodeJSONOldVersion(t *testing.T) {
+	// Replays before version 6 stop after the AFKs
+	r, err := DecodeJSON([]byte(`[5,"old",2,1,["a","b"],[0,0],[],[],[0,1],[],[[0,0,1,1,1]],[]]`))
+	if err != nil {
+		t.Fatalf("DecodeJSON: %v", err)
+	}
+	want := []Move{{Index: 0, Start: 0, End: 1, Is50: true, Turn: 1}}
+	if r.Version != 5 || r.Teams != nil || r.MapTitle != "" || !reflect.DeepEqual(r.Moves, want) {
+		t.Errorf("DecodeJSON = %+v", r)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	for _, data := range []string{
+		`{}`,
+		`[7,"short",1,1]`,
+		`[7,"bad",1,1,[],[],[],[],[],[],[[0,0,1]],[]]`,
+		`[7,"bad",1,1,[],[],[],[],[],[],[],[[0]]]`,
+		`[7,5,1,1,[],[],[],[],[],[],[],[]]`,
+	} {
+		if _, err := DecodeJSON([]byte(data)); err == nil {
+			t.Errorf("DecodeJSON(%s) succeeded, want an error", data)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/brisberg/generals-io-bot/client"
+)
+
+// Account as written in an accounts file
+type accountConfig struct {
+	UserID   string `json:"userID"`
+	Username string `json:"username"`
+	Lobby    string `json:"lobby"`
+	// Name of the queue: "1v1", "FFA" or "2v2". Empty lets the supervisor assign one
+	Queue  string `json:"queue"`
+	TeamID string `json:"team"`
+}
+
+// LoadAccounts reads accounts from a JSON array of objects with the fields userID, username, and
+// optionally lobby, queue ("1v1", "FFA" or "2v2") and team
+func LoadAccounts(r io.Reader) ([]Account, error) {
+	configs := []accountConfig{}
+	if err := json.NewDecoder(r).Decode(&configs); err != nil {
+		return nil, fmt.Errorf("Error: Invalid accounts file: %v", err)
+	}
+
+	accounts := make([]Account, len(configs))
+	for i, c := range configs {
+		if c.UserID == "" || c.Username == "" {
+			return nil, fmt.Errorf("Error: Account %v must have a userID and username", i)
+		}
+		a := Account{UserID: c.UserID, Username: c.Username, Lobby: c.Lobby, TeamID: c.TeamID}
+		if c.Queue != "" {
+			for _, kind := range []client.QueueKind{client.Queue1v1, client.QueueFFA, client.QueueTeam} {
+				if c.Queue == kind.String() {
+					a.Queue = kind
+				}
+			}
+			if a.Queue == 0 {
+				return nil, fmt.Errorf("Error: Account %v has unknown queue %q", c.Username, c.Queue)
+			}
+		}
+		if a.Lobby == "" && a.Queue == client.QueueTeam && a.TeamID == "" {
+			return nil, fmt.Errorf("Error: Account %v must have a team to join the 2v2 queue", c.Username)
+		}
+		accounts[i] = a
+	}
+	return accounts, nil
+}
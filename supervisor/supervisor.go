@@ -0,0 +1,408 @@
+// Package supervisor runs a fleet of bot accounts in one process.
+//
+// Each account gets its own Client, game loop and Strategy. Accounts play continuous sessions in a
+// custom lobby or a matchmaking queue, and are restarted with backoff when their client fails or
+// their strategy panics.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/client"
+	"github.com/brisberg/generals-io-bot/game"
+	"github.com/brisberg/generals-io-bot/logger"
+)
+
+// Strategy plays the games of an account
+type Strategy interface {
+	// Play plays one game. The context is done once the game is over or the supervisor stops.
+	// The client keeps updating g on its own goroutine, so read the game through g.Snapshot()
+	Play(ctx context.Context, c *client.Client, g *game.Game) error
+}
+
+// StrategyFunc adapts a function to the Strategy interface
+type StrategyFunc func(ctx context.Context, c *client.Client, g *game.Game) error
+
+// Play calls f
+func (f StrategyFunc) Play(ctx context.Context, c *client.Client, g *game.Game) error {
+	return f(ctx, c, g)
+}
+
+// Account is a bot account managed by the supervisor
+type Account struct {
+	UserID   string
+	Username string
+	// ID of the custom lobby to play in. Empty plays in Queue
+	Lobby string
+	// Matchmaking queue to play in. 0 assigns one of the supervisor's Queues
+	Queue client.QueueKind
+	// Team to join in the 2v2 queue
+	TeamID string
+	// Strategy playing the games. Nil uses the supervisor's Strategy
+	Strategy Strategy
+}
+
+// Status is the state of an account, as reported by Supervisor.Status
+type Status struct {
+	UserID   string
+	Username string
+	Lobby    string
+	Queue    client.QueueKind
+	// Lifecycle state of the account's client
+	State client.State
+	// True while the account is running, false once it finished or the supervisor stopped
+	Running  bool
+	Games    int
+	Wins     int
+	Restarts int
+	// Error which caused the last restart
+	LastError error
+}
+
+// Supervisor manages a pool of bot accounts
+type Supervisor struct {
+	// Options used to connect the client of each account. Logger gets a user field per account
+	Options client.Options
+	// Policy for reconnecting each client. Nil disables reconnecting
+	ReconnectPolicy *client.ReconnectPolicy
+	// Policy for restarting an account whose client failed. Nil uses client.DefaultReconnectPolicy
+	RestartPolicy *client.ReconnectPolicy
+	// Session settings of each client. OnGameResult is called for the games of every account
+	Session client.Session
+	// Queues accounts without a lobby or queue are spread across. Defaults to the 1v1 and FFA queues
+	Queues []client.QueueKind
+	// Strategy of accounts without their own
+	Strategy Strategy
+	// Time allowed for connecting, registering and joining. Defaults to 30s
+	StartTimeout time.Duration
+	// Called whenever the status of an account changes
+	OnStatus func(Status)
+
+	mu   sync.Mutex
+	bots []*bot
+}
+
+// Per account state
+type bot struct {
+	s       *Supervisor
+	account Account
+	log     logger.Logger
+
+	mu     sync.Mutex
+	client *client.Client
+	status Status
+}
+
+// Add adds an account to the pool. Accounts added while Run is running start on the next Run
+func (s *Supervisor) Add(a Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a.Lobby == "" && a.Queue == 0 {
+		queues := s.Queues
+		if len(queues) == 0 {
+			queues = []client.QueueKind{client.Queue1v1, client.QueueFFA}
+		}
+		a.Queue = queues[len(s.bots)%len(queues)]
+	}
+	b := &bot{
+		s:       s,
+		account: a,
+		log:     logger.Or(s.Options.Logger).With("user", a.Username),
+	}
+	b.status = Status{UserID: a.UserID, Username: a.Username, Lobby: a.Lobby, Queue: a.Queue}
+	s.bots = append(s.bots, b)
+}
+
+// Status returns the status of every account, in the order they were added
+func (s *Supervisor) Status() []Status {
+	s.mu.Lock()
+	bots := append([]*bot{}, s.bots...)
+	s.mu.Unlock()
+
+	statuses := make([]Status, len(bots))
+	for i, b := range bots {
+		statuses[i] = b.snapshot()
+	}
+	return statuses
+}
+
+// Run runs every account until the context is done, or until all accounts finished their
+// sessions. Accounts whose client fails are restarted with backoff.
+func (s *Supervisor) Run(ctx context.Context) error {
+	s.mu.Lock()
+	bots := append([]*bot{}, s.bots...)
+	s.mu.Unlock()
+	if len(bots) == 0 {
+		return errors.New("Error: No accounts to run")
+	}
+
+	var wg sync.WaitGroup
+	for _, b := range bots {
+		wg.Add(1)
+		go func(b *bot) {
+			defer wg.Done()
+			b.run(ctx)
+		}(b)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// Runs the account, restarting it until its session finishes or the context is done
+func (b *bot) run(ctx context.Context) {
+	policy := b.s.RestartPolicy
+	if policy == nil {
+		policy = client.DefaultReconnectPolicy()
+	}
+	backoff := policy.InitialBackoff
+
+	b.update(func(s *Status) { s.Running = true })
+	defer b.update(func(s *Status) { s.Running = false })
+
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		err := b.runOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			b.log.Info("Session finished")
+			return
+		}
+		if permanent(err) {
+			b.log.Error("Account can not play", "err", err)
+			b.update(func(s *Status) { s.LastError = err })
+			return
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			b.log.Error("Giving up on account", "attempts", attempt, "err", err)
+			b.update(func(s *Status) { s.LastError = err })
+			return
+		}
+
+		// A bot which ran for longer than the longest backoff is healthy again, start backing off
+		// from scratch. Without a cap the backoff keeps growing
+		if policy.MaxBackoff > 0 && time.Since(started) > policy.MaxBackoff {
+			backoff = policy.InitialBackoff
+		}
+		b.log.Warn("Restarting account", "err", err, "backoff", backoff)
+		b.update(func(s *Status) {
+			s.Restarts++
+			s.LastError = err
+		})
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = time.Duration(float64(backoff) * policy.Multiplier)
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// Returns true for errors of the account itself, which restarting does not fix
+func permanent(err error) bool {
+	for _, target := range []error{
+		client.ErrBanned,
+		client.ErrInvalidUserID,
+		client.ErrUsernameTaken,
+		client.ErrInvalidUsername,
+		client.ErrUsernameLocked,
+		client.ErrMissingCredentials,
+		client.ErrMissingTeamID,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Connects a client for the account and plays until the client closes. Returns nil if the session
+// finished, or the error which closed the client
+func (b *bot) runOnce(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	options := b.s.Options
+	options.Logger = b.log
+	c, err := client.ConnectWithOptions(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer c.Close("Account stopped.")
+	b.setClient(c)
+
+	c.ReconnectPolicy = b.s.ReconnectPolicy
+	c.UseGameConstructor(func() client.IGame {
+		return &game.Game{Logger: b.log}
+	})
+	session := b.s.Session
+	session.OnGameResult = func(r client.GameResult) {
+		b.update(func(s *Status) {
+			s.Games++
+			if r.Won {
+				s.Wins++
+			}
+		})
+		if b.s.Session.OnGameResult != nil {
+			b.s.Session.OnGameResult(r)
+		}
+	}
+	c.Session = &session
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- c.Run(ctx) }()
+
+	if err := b.join(ctx, c); err != nil {
+		return err
+	}
+	if err := b.play(ctx, c); err != nil {
+		return err
+	}
+	<-runErr
+	return c.Err()
+}
+
+// Registers the account and joins its lobby or queue
+func (b *bot) join(ctx context.Context, c *client.Client) error {
+	timeout := b.s.StartTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	a := b.account
+	if err := c.RegisterBot(ctx, a.UserID, a.Username); err != nil {
+		return err
+	}
+
+	var err error
+	switch {
+	case a.Lobby != "":
+		err = c.JoinCustomGame(ctx, a.Lobby)
+	case a.Queue == client.Queue1v1:
+		err = c.Join1v1(ctx)
+	case a.Queue == client.QueueTeam:
+		err = c.JoinTeam(ctx, a.TeamID)
+	default:
+		err = c.JoinFFA(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if b.s.Session.ForceStart && a.Queue != client.Queue1v1 {
+		return c.SetForceStart(true)
+	}
+	return nil
+}
+
+// Plays games with the account's strategy until the client is closed
+func (b *bot) play(ctx context.Context, c *client.Client) error {
+	strategy := b.account.Strategy
+	if strategy == nil {
+		strategy = b.s.Strategy
+	}
+	if strategy == nil {
+		return errors.New("Error: No strategy for account " + b.account.Username)
+	}
+
+	for {
+		if err := c.WaitForGameStart(ctx); err != nil {
+			if errors.Is(err, client.ErrClientClosed) {
+				return nil
+			}
+			return err
+		}
+		g, ok := c.Game().(*game.Game)
+		if !ok {
+			return errors.New("Error: Client has no game instance")
+		}
+
+		gameCtx, cancel := context.WithCancel(ctx)
+		go waitForGameOver(c, cancel)
+		if err := playSafely(gameCtx, strategy, c, g); err != nil && gameCtx.Err() == nil {
+			cancel()
+			return err
+		}
+		<-gameCtx.Done()
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// Calls done once the client leaves the game being played, or closes. Reconnecting during the game
+// does not count as leaving it
+func waitForGameOver(c *client.Client, done func()) {
+	defer done()
+	states, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+	if c.State() != client.StateInGame {
+		return
+	}
+	for change := range states {
+		if change.From == client.StateInGame && change.To != client.StateDialing {
+			return
+		}
+	}
+}
+
+// Plays a game, turning a panic of the strategy into an error
+func playSafely(ctx context.Context, strategy Strategy, c *client.Client, g *game.Game) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Error: Strategy panicked: %v", r)
+		}
+	}()
+	return strategy.Play(ctx, c, g)
+}
+
+func (b *bot) setClient(c *client.Client) {
+	b.mu.Lock()
+	b.client = c
+	b.mu.Unlock()
+
+	states, _ := c.Subscribe()
+	go func() {
+		for range states {
+			b.notify()
+		}
+	}()
+}
+
+// Changes the status of the account and notifies OnStatus
+func (b *bot) update(change func(s *Status)) {
+	b.mu.Lock()
+	change(&b.status)
+	b.mu.Unlock()
+	b.notify()
+}
+
+func (b *bot) notify() {
+	if b.s.OnStatus != nil {
+		b.s.OnStatus(b.snapshot())
+	}
+}
+
+// Returns a copy of the status with the current state of the client
+func (b *bot) snapshot() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.status
+	s.State = client.StateClosed
+	if b.client != nil {
+		s.State = b.client.State()
+	}
+	return s
+}
@@ -0,0 +1,217 @@
+package supervisor_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brisberg/generals-io-bot/client"
+	"github.com/brisberg/generals-io-bot/client/fakeserver"
+	"github.com/brisberg/generals-io-bot/game"
+	"github.com/brisberg/generals-io-bot/logger"
+	"github.com/brisberg/generals-io-bot/supervisor"
+)
+
+const timeout = 5 * time.Second
+
+// Strategy which returns as soon as the game starts
+var idle = supervisor.StrategyFunc(func(context.Context, *client.Client, *game.Game) error { return nil })
+
+// Builds a supervisor playing against the fake server
+func newSupervisor(s *fakeserver.Server, restart *client.ReconnectPolicy) *supervisor.Supervisor {
+	return &supervisor.Supervisor{
+		Options:       client.Options{URL: s.URL(), Logger: logger.Nop()},
+		RestartPolicy: restart,
+		Strategy:      idle,
+		StartTimeout:  timeout,
+	}
+}
+
+// Runs the supervisor, failing the test if it does not finish in time
+func runSupervisor(t *testing.T, sup *supervisor.Supervisor) time.Duration {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	if err := sup.Run(ctx); err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+	return time.Since(start)
+}
+
+// Makes the server reject every join of the 1v1 queue with the given error event
+func rejectQueue(s *fakeserver.Server, event, message string) {
+	s.Handle("join_1v1", func(conn *fakeserver.Conn, e fakeserver.Event) {
+		conn.Emit(event, message)
+	})
+}
+
+func TestAddSpreadsQueues(t *testing.T) {
+	sup := &supervisor.Supervisor{Queues: []client.QueueKind{client.QueueFFA, client.Queue1v1}}
+	sup.Add(supervisor.Account{UserID: "user1", Username: "[Bot]one"})
+	sup.Add(supervisor.Account{UserID: "user2", Username: "[Bot]two"})
+	sup.Add(supervisor.Account{UserID: "user3", Username: "[Bot]three", Lobby: "lobby1"})
+	sup.Add(supervisor.Account{UserID: "user4", Username: "[Bot]four", Queue: client.QueueTeam, TeamID: "team1"})
+	sup.Add(supervisor.Account{UserID: "user5", Username: "[Bot]five"})
+
+	want := []supervisor.Status{
+		{UserID: "user1", Username: "[Bot]one", Queue: client.QueueFFA},
+		{UserID: "user2", Username: "[Bot]two", Queue: client.Queue1v1},
+		{UserID: "user3", Username: "[Bot]three", Lobby: "lobby1"},
+		{UserID: "user4", Username: "[Bot]four", Queue: client.QueueTeam},
+		{UserID: "user5", Username: "[Bot]five", Queue: client.QueueFFA},
+	}
+	statuses := sup.Status()
+	if len(statuses) != len(want) {
+		t.Fatalf("Status() has %v accounts, want %v", len(statuses), len(want))
+	}
+	for i, w := range want {
+		w.State = client.StateClosed
+		if statuses[i] != w {
+			t.Errorf("Status()[%v] = %+v, want %+v", i, statuses[i], w)
+		}
+	}
+}
+
+func TestAddDefaultQueues(t *testing.T) {
+	sup := &supervisor.Supervisor{}
+	for _, id := range []string{"user1", "user2", "user3"} {
+		sup.Add(supervisor.Account{UserID: id, Username: "[Bot]" + id})
+	}
+	for i, want := range []client.QueueKind{client.Queue1v1, client.QueueFFA, client.Queue1v1} {
+		if got := sup.Status()[i].Queue; got != want {
+			t.Errorf("account %v queue = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestRunWithoutAccounts(t *testing.T) {
+	if err := (&supervisor.Supervisor{}).Run(context.Background()); err == nil {
+		t.Error("Run without accounts = nil, want an error")
+	}
+}
+
+func TestRunPlaysSession(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	s.SetUsername("user1", "[Bot]one")
+	sup := newSupervisor(s, nil)
+	sup.Session = client.Session{MaxGames: 1}
+	played := make(chan bool, 1)
+	sup.Strategy = supervisor.StrategyFunc(func(ctx context.Context, c *client.Client, g *game.Game) error {
+		played <- true
+		return nil
+	})
+	sup.Add(supervisor.Account{UserID: "user1", Username: "[Bot]one", Lobby: "lobby1"})
+
+	done := make(chan time.Duration, 1)
+	go func() { done <- runSupervisor(t, sup) }()
+	if _, err := s.Next("join_private", timeout); err != nil {
+		t.Fatal(err)
+	}
+	s.StartGame(fakeserver.GameStart{PlayerIndex: 0, ReplayID: "replay1", Usernames: []string{"[Bot]one", "other"}})
+	select {
+	case <-played:
+	case <-time.After(timeout):
+		t.Fatal("strategy was not called for the game")
+	}
+	s.EndGame(true)
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("Run did not return after the session finished")
+	}
+	st := sup.Status()[0]
+	if st.Running || st.Games != 1 || st.Wins != 1 || st.Restarts != 0 || st.LastError != nil || st.State != client.StateClosed {
+		t.Errorf("Status() = %+v, want one game won", st)
+	}
+}
+
+func TestRunRestartsAccount(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	rejectQueue(s, "error_queue", "The queue is closed.")
+	sup := newSupervisor(s, &client.ReconnectPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, Multiplier: 1})
+	statuses := make(chan supervisor.Status, 64)
+	sup.OnStatus = func(st supervisor.Status) {
+		select {
+		case statuses <- st:
+		default:
+		}
+	}
+	sup.Add(supervisor.Account{UserID: "user1", Username: "[Bot]one", Queue: client.Queue1v1})
+	runSupervisor(t, sup)
+
+	// Every attempt joined the queue again, then the account gave up
+	for i := 0; i < 3; i++ {
+		if _, err := s.Next("join_1v1", timeout); err != nil {
+			t.Fatalf("attempt %v: %v", i+1, err)
+		}
+	}
+	st := sup.Status()[0]
+	if st.Running || st.Restarts != 2 || !errors.Is(st.LastError, client.ErrQueue) {
+		t.Errorf("Status() = %+v, want 2 restarts after queue errors", st)
+	}
+
+	// Notifications of the last client's state may still arrive, so only drain what is there
+	running := false
+	for drained := false; !drained; {
+		select {
+		case st := <-statuses:
+			running = running || st.Running
+		default:
+			drained = true
+		}
+	}
+	if !running {
+		t.Error("OnStatus never reported the account running")
+	}
+}
+
+func TestRunStopsOnPermanentError(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	rejectQueue(s, "error_banned", "You are banned.")
+	sup := newSupervisor(s, &client.ReconnectPolicy{InitialBackoff: 10 * time.Millisecond, Multiplier: 1})
+	sup.Add(supervisor.Account{UserID: "user1", Username: "[Bot]one", Queue: client.Queue1v1})
+	runSupervisor(t, sup)
+
+	st := sup.Status()[0]
+	if st.Running || st.Restarts != 0 || !errors.Is(st.LastError, client.ErrBanned) {
+		t.Errorf("Status() = %+v, want no restarts after a ban", st)
+	}
+	if joins := s.Received("join_1v1"); len(joins) != 1 {
+		t.Errorf("joined the queue %v times, want 1", len(joins))
+	}
+}
+
+func TestRunBacksOffWithoutCap(t *testing.T) {
+	s := fakeserver.New()
+	defer s.Close()
+	var mu sync.Mutex
+	joined := []time.Time{}
+	s.Handle("join_1v1", func(conn *fakeserver.Conn, e fakeserver.Event) {
+		mu.Lock()
+		joined = append(joined, time.Now())
+		mu.Unlock()
+		conn.Emit("error_queue", "The queue is closed.")
+	})
+	// Without a MaxBackoff the backoff doubles after every restart: 40ms, 80ms then 160ms
+	sup := newSupervisor(s, &client.ReconnectPolicy{MaxAttempts: 4, InitialBackoff: 40 * time.Millisecond, Multiplier: 2})
+	sup.Add(supervisor.Account{UserID: "user1", Username: "[Bot]one", Queue: client.Queue1v1})
+	runSupervisor(t, sup)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(joined) != 4 {
+		t.Fatalf("joined the queue %v times, want 4", len(joined))
+	}
+	// Connecting takes as long each time, so the gaps between the joins grow with the backoff
+	first, last := joined[1].Sub(joined[0]), joined[3].Sub(joined[2])
+	if last-first < 100*time.Millisecond {
+		t.Errorf("gap between joins grew from %v to %v, want it to grow by 120ms", first, last)
+	}
+}